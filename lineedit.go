@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// history_size is the number of lines kept in the history file.
+const history_size = 1000
+
+const history_file = ".glox_history"
+
+// err_interrupt is returned by read_line when the user presses Ctrl-C.
+var err_interrupt = errors.New("interrupted")
+
+// line_reader reads the lines typed into the REPL.
+type line_reader interface {
+	read_line(prompt string) (string, error)
+	close()
+}
+
+// new_line_reader returns a line editor when stdin and stdout are
+// terminals, and otherwise reads plain lines from stdin.
+func new_line_reader() line_reader {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if is_terminal(in) && is_terminal(out) {
+		return &line_editor{in: bufio.NewReader(os.Stdin), out: os.Stdout, fd: in, history: load_history()}
+	}
+	return &plain_reader{bufio.NewScanner(os.Stdin)}
+}
+
+type plain_reader struct {
+	scanner *bufio.Scanner
+}
+
+func (pr *plain_reader) read_line(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if pr.scanner.Scan() {
+		return pr.scanner.Text(), nil
+	}
+	if err := pr.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+func (pr *plain_reader) close() {}
+
+// history holds the lines entered in this and earlier sessions, and
+// appends new ones to the history file as they are entered.
+type history struct {
+	lines []string
+	file  *os.File
+}
+
+// load_history reads ~/.glox_history, trimming it to its last
+// history_size lines. Without a home directory the history only lasts
+// for the session.
+func load_history() *history {
+	h := &history{}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return h
+	}
+	path := filepath.Join(home, history_file)
+	if bytes, err := os.ReadFile(path); err == nil {
+		h.lines = strings.Split(strings.TrimSuffix(string(bytes), "\n"), "\n")
+		if len(h.lines) == 1 && h.lines[0] == "" {
+			h.lines = nil
+		}
+		if len(h.lines) > history_size {
+			h.lines = h.lines[len(h.lines)-history_size:]
+			os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+		}
+	}
+	h.file, _ = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	return h
+}
+
+// add records line, unless it is blank or repeats the last line.
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return
+	}
+	h.lines = append(h.lines, line)
+	if h.file != nil {
+		fmt.Fprintln(h.file, line)
+	}
+}
+
+func (h *history) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
+
+// Keys that are not characters, as returned by read_key.
+const (
+	key_up rune = -1 - iota
+	key_down
+	key_left
+	key_right
+	key_home
+	key_end
+	key_delete
+	key_unknown
+)
+
+const (
+	ctrl_a     = 1
+	ctrl_b     = 2
+	ctrl_c     = 3
+	ctrl_d     = 4
+	ctrl_e     = 5
+	ctrl_f     = 6
+	ctrl_h     = 8
+	tab        = 9
+	ctrl_k     = 11
+	ctrl_l     = 12
+	enter      = 13
+	ctrl_n     = 14
+	ctrl_p     = 16
+	ctrl_u     = 21
+	ctrl_w     = 23
+	escape     = 27
+	backspace  = 127
+	line_break = '\n'
+)
+
+// line_editor reads lines from a terminal in raw mode. It supports moving
+// the cursor, the usual Emacs editing keys, and browsing the history with
+// the up and down arrows.
+type line_editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	history *history
+}
+
+func (le *line_editor) close() {
+	le.history.close()
+}
+
+func (le *line_editor) read_line(prompt string) (string, error) {
+	restore, err := make_raw(le.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	var line []rune
+	cursor := 0
+	// browsing is the history line shown, and draft the line being typed
+	// before browsing started.
+	browsing := len(le.history.lines)
+	draft := ""
+	show := func(text string) {
+		line = []rune(text)
+		cursor = len(line)
+	}
+	for {
+		le.refresh(prompt, line, cursor)
+		key, err := le.read_key()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case enter, line_break:
+			fmt.Fprint(le.out, "\r\n")
+			le.history.add(string(line))
+			return string(line), nil
+		case ctrl_c:
+			fmt.Fprint(le.out, "^C\r\n")
+			return "", err_interrupt
+		case ctrl_d:
+			if len(line) == 0 {
+				fmt.Fprint(le.out, "\r\n")
+				return "", io.EOF
+			}
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+		case key_delete:
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+		case backspace, ctrl_h:
+			if cursor > 0 {
+				line = append(line[:cursor-1], line[cursor:]...)
+				cursor--
+			}
+		case key_left, ctrl_b:
+			cursor = max(cursor-1, 0)
+		case key_right, ctrl_f:
+			cursor = min(cursor+1, len(line))
+		case key_home, ctrl_a:
+			cursor = 0
+		case key_end, ctrl_e:
+			cursor = len(line)
+		case ctrl_k:
+			line = line[:cursor]
+		case ctrl_u:
+			line = line[cursor:]
+			cursor = 0
+		case ctrl_w:
+			start := cursor
+			for start > 0 && unicode.IsSpace(line[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(line[start-1]) {
+				start--
+			}
+			line = append(line[:start], line[cursor:]...)
+			cursor = start
+		case ctrl_l:
+			fmt.Fprint(le.out, "\x1b[H\x1b[2J")
+		case key_up, ctrl_p:
+			if browsing > 0 {
+				if browsing == len(le.history.lines) {
+					draft = string(line)
+				}
+				browsing--
+				show(le.history.lines[browsing])
+			}
+		case key_down, ctrl_n:
+			if browsing < len(le.history.lines) {
+				browsing++
+				if browsing == len(le.history.lines) {
+					show(draft)
+				} else {
+					show(le.history.lines[browsing])
+				}
+			}
+		case tab:
+			line = append(line[:cursor], append([]rune("  "), line[cursor:]...)...)
+			cursor += 2
+		default:
+			if key >= ' ' {
+				line = append(line[:cursor], append([]rune{key}, line[cursor:]...)...)
+				cursor++
+			}
+		}
+	}
+}
+
+// refresh redraws the line and puts the terminal cursor at cursor.
+func (le *line_editor) refresh(prompt string, line []rune, cursor int) {
+	fmt.Fprintf(le.out, "\r%s%s\x1b[K", prompt, string(line))
+	if back := len(line) - cursor; back > 0 {
+		fmt.Fprintf(le.out, "\x1b[%dD", back)
+	}
+}
+
+// read_key reads one character, or one of the escape sequences terminals
+// send for the arrow, home, end and delete keys.
+func (le *line_editor) read_key() (rune, error) {
+	first, err := le.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first != escape {
+		if first < utf8.RuneSelf {
+			return rune(first), nil
+		}
+		bytes := []byte{first}
+		for !utf8.FullRune(bytes) {
+			next, err := le.in.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			bytes = append(bytes, next)
+		}
+		key, _ := utf8.DecodeRune(bytes)
+		return key, nil
+	}
+	kind, err := le.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if kind != '[' && kind != 'O' {
+		return key_unknown, nil
+	}
+	// The sequence ends with a byte in the range @ to ~, after any
+	// numeric parameters.
+	var params []byte
+	for {
+		next, err := le.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if next >= '@' && next <= '~' {
+			return escape_key(string(params), next), nil
+		}
+		params = append(params, next)
+	}
+}
+
+func escape_key(params string, final byte) rune {
+	switch final {
+	case 'A':
+		return key_up
+	case 'B':
+		return key_down
+	case 'C':
+		return key_right
+	case 'D':
+		return key_left
+	case 'H':
+		return key_home
+	case 'F':
+		return key_end
+	case '~':
+		switch params {
+		case "1", "7":
+			return key_home
+		case "4", "8":
+			return key_end
+		case "3":
+			return key_delete
+		}
+	}
+	return key_unknown
+}
@@ -0,0 +1,404 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var error_type = reflect.TypeOf((*error)(nil)).Elem()
+
+// DefineObject exposes a Go struct to scripts as the global name. The
+// struct's exported fields can be read and written and its exported
+// methods called. obj must be a pointer to a struct so that changes made
+// by the script are visible to the host.
+func (interp *Interpreter) DefineObject(name string, obj interface{}) error {
+	value := reflect.ValueOf(obj)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("DefineObject: %s must be a non-nil pointer to a struct, got %T", name, obj)
+	}
+	interp.builtins.define(name, GoInstance{value.Elem()})
+	return nil
+}
+
+// DefineClass exposes a Go constructor to scripts as a class called name.
+// constructor must be a function returning a struct or a pointer to a
+// struct, optionally followed by an error. Calling the class from Lox
+// converts the arguments, calls constructor and wraps the result.
+func (interp *Interpreter) DefineClass(name string, constructor interface{}) error {
+	function := reflect.ValueOf(constructor)
+	if function.Kind() != reflect.Func || function.IsNil() {
+		return fmt.Errorf("DefineClass: constructor for %s must be a function, got %T", name, constructor)
+	}
+	f_type := function.Type()
+	returns_err := f_type.NumOut() == 2 && f_type.Out(1) == error_type
+	if f_type.NumOut() != 1 && !returns_err {
+		return fmt.Errorf("DefineClass: constructor for %s must return a value and an optional error", name)
+	}
+	result := f_type.Out(0)
+	if result.Kind() == reflect.Pointer {
+		result = result.Elem()
+	}
+	if result.Kind() != reflect.Struct {
+		return fmt.Errorf("DefineClass: constructor for %s must return a struct, got %v", name, f_type.Out(0))
+	}
+	interp.builtins.define(name, GoClass{name, function})
+	return nil
+}
+
+// Type representing a Go constructor exposed as a Lox class
+type GoClass struct {
+	name        string
+	constructor reflect.Value
+}
+
+func (gc GoClass) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return call_go(gc.name, gc.constructor, arguments)
+}
+
+func (gc GoClass) arity() int {
+	return go_arity(gc.constructor)
+}
+
+func (gc GoClass) String() string {
+	return gc.name
+}
+
+// Type representing a Go function or bound method callable from Lox
+type GoFunction struct {
+	name     string
+	function reflect.Value
+}
+
+func (gf GoFunction) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return call_go(gf.name, gf.function, arguments)
+}
+
+func (gf GoFunction) arity() int {
+	return go_arity(gf.function)
+}
+
+func (gf GoFunction) String() string {
+	return "<native fn>"
+}
+
+// Type representing a Go value seen from Lox. Struct values are kept
+// addressable so that field assignments write through to the host.
+type GoInstance struct {
+	value reflect.Value
+}
+
+func (gi GoInstance) get(name Token) (Value, error) {
+	if gi.value.Kind() == reflect.Struct {
+		if field, ok := gi.value.Type().FieldByName(name.lexeme); ok && field.IsExported() {
+			val, err := gi.value.FieldByIndexErr(field.Index)
+			if err != nil {
+				return nil, RuntimeError{"Cannot read field '" + name.lexeme + "': " + err.Error(), name}
+			}
+			return from_go(val), nil
+		}
+	}
+	receiver := gi.value
+	if receiver.CanAddr() {
+		receiver = receiver.Addr()
+	}
+	if method := receiver.MethodByName(name.lexeme); method.IsValid() {
+		return GoFunction{name.lexeme, method}, nil
+	}
+	return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+}
+
+func (gi GoInstance) set(name Token, val Value) error {
+	if gi.value.Kind() != reflect.Struct {
+		return RuntimeError{"Only struct values have fields.", name}
+	}
+	field, ok := gi.value.Type().FieldByName(name.lexeme)
+	if !ok || !field.IsExported() {
+		return RuntimeError{"Undefined field '" + name.lexeme + "'.", name}
+	}
+	target, err := gi.value.FieldByIndexErr(field.Index)
+	if err != nil || !target.CanSet() {
+		return RuntimeError{"Cannot assign to field '" + name.lexeme + "'.", name}
+	}
+	converted, err := to_go(val, field.Type)
+	if err != nil {
+		return RuntimeError{"Cannot assign to field '" + name.lexeme + "': " + err.Error(), name}
+	}
+	target.Set(converted)
+	return nil
+}
+
+func (gi GoInstance) String() string {
+	return gi.value.Type().String() + " instance"
+}
+
+func go_arity(function reflect.Value) int {
+	if function.Type().IsVariadic() {
+		return Variadic
+	}
+	return function.Type().NumIn()
+}
+
+func call_go(name string, function reflect.Value, arguments []Value) (Value, error) {
+	f_type := function.Type()
+	n_params := f_type.NumIn()
+	if f_type.IsVariadic() && len(arguments) < n_params-1 {
+		return nil, fmt.Errorf("Expected at least %d arguments but got %d.", n_params-1, len(arguments))
+	}
+	in := make([]reflect.Value, len(arguments))
+	for i, arg := range arguments {
+		var param reflect.Type
+		if f_type.IsVariadic() && i >= n_params-1 {
+			param = f_type.In(n_params - 1).Elem()
+		} else {
+			param = f_type.In(i)
+		}
+		converted, err := to_go(arg, param)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %d to '%s': %v", i+1, name, err)
+		}
+		in[i] = converted
+	}
+	out := function.Call(in)
+	if len(out) > 0 && f_type.Out(len(out)-1) == error_type {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return from_go(out[0]), nil
+}
+
+// from_go converts a Go value returned to a script into a Lox value.
+// Numbers become float64, slices and maps are copied into lists and maps,
+// and structs are wrapped.
+func from_go(val reflect.Value) Value {
+	switch val.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Bool:
+		return val.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return val.Float()
+	case reflect.String:
+		return val.String()
+	case reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		return from_go(val.Elem())
+	case reflect.Pointer:
+		if val.IsNil() {
+			return nil
+		}
+		if val.Elem().Kind() == reflect.Struct {
+			return GoInstance{val.Elem()}
+		}
+		return GoInstance{val}
+	case reflect.Struct:
+		if !val.CanAddr() {
+			copied := reflect.New(val.Type()).Elem()
+			copied.Set(val)
+			val = copied
+		}
+		return GoInstance{val}
+	case reflect.Func:
+		if val.IsNil() {
+			return nil
+		}
+		return GoFunction{"anonymous", val}
+	case reflect.Slice, reflect.Array:
+		if val.Kind() == reflect.Slice && val.IsNil() {
+			return nil
+		}
+		elements := make([]Value, val.Len())
+		for i := range elements {
+			elements[i] = from_go(val.Index(i))
+		}
+		return &LoxList{elements}
+	case reflect.Map:
+		if val.IsNil() {
+			return nil
+		}
+		return map_from_go(val)
+	}
+	return GoInstance{val}
+}
+
+// to_go converts a Lox value into a Go value of type target.
+func to_go(val Value, target reflect.Type) (reflect.Value, error) {
+	if val == nil {
+		switch target.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(target), nil
+		}
+		return reflect.Value{}, fmt.Errorf("expected %v but got nil", target)
+	}
+	if inst, ok := val.(GoInstance); ok {
+		if inst.value.Type().AssignableTo(target) {
+			return inst.value, nil
+		}
+		if inst.value.CanAddr() && inst.value.Addr().Type().AssignableTo(target) {
+			return inst.value.Addr(), nil
+		}
+		return reflect.Value{}, fmt.Errorf("expected %v but got %v", target, inst.value.Type())
+	}
+	switch target.Kind() {
+	case reflect.Bool:
+		if b, ok := val.(bool); ok {
+			return reflect.ValueOf(b).Convert(target), nil
+		}
+	case reflect.String:
+		if s, ok := val.(string); ok {
+			return reflect.ValueOf(s).Convert(target), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := val.(float64); ok {
+			if target.Kind() == reflect.Float32 && reflect.Zero(target).OverflowFloat(f) {
+				return reflect.Value{}, fmt.Errorf("%v overflows %v", f, target)
+			}
+			return reflect.ValueOf(f).Convert(target), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f, ok := val.(float64); ok {
+			if err := check_integer(f); err != nil {
+				return reflect.Value{}, err
+			}
+			if f < math.MinInt64 || f >= math.MaxInt64 || reflect.Zero(target).OverflowInt(int64(f)) {
+				return reflect.Value{}, fmt.Errorf("%v overflows %v", f, target)
+			}
+			return reflect.ValueOf(int64(f)).Convert(target), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f, ok := val.(float64); ok {
+			if err := check_integer(f); err != nil {
+				return reflect.Value{}, err
+			}
+			if f < 0 || f >= math.MaxUint64 || reflect.Zero(target).OverflowUint(uint64(f)) {
+				return reflect.Value{}, fmt.Errorf("%v overflows %v", f, target)
+			}
+			return reflect.ValueOf(uint64(f)).Convert(target), nil
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := val.(*LoxList); ok {
+			return list_to_go(list, target)
+		}
+	case reflect.Map:
+		if entries, ok := val.(*LoxMap); ok {
+			return map_to_go(entries, target)
+		}
+	case reflect.Interface:
+		if reflect.TypeOf(val).AssignableTo(target) {
+			return reflect.ValueOf(val), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("expected %v but got %s", target, type_name(val))
+}
+
+func list_to_go(list *LoxList, target reflect.Type) (reflect.Value, error) {
+	var result reflect.Value
+	if target.Kind() == reflect.Array {
+		if len(list.elements) != target.Len() {
+			return reflect.Value{}, fmt.Errorf("expected a list of length %d but got %d", target.Len(), len(list.elements))
+		}
+		result = reflect.New(target).Elem()
+	} else {
+		result = reflect.MakeSlice(target, len(list.elements), len(list.elements))
+	}
+	for i, element := range list.elements {
+		converted, err := to_go(element, target.Elem())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("element %d: %v", i, err)
+		}
+		result.Index(i).Set(converted)
+	}
+	return result, nil
+}
+
+func map_from_go(val reflect.Value) Value {
+	values := make(map[Value]Value, val.Len())
+	keys := make([]Value, 0, val.Len())
+	wrapped := false
+	iter := val.MapRange()
+	for iter.Next() {
+		key := from_go(iter.Key())
+		if !valid_key(key) {
+			wrapped = true
+			break
+		}
+		keys = append(keys, key)
+		values[key] = from_go(iter.Value())
+	}
+	// Maps whose keys have no Lox equivalent are passed through as is.
+	if wrapped {
+		return GoInstance{val}
+	}
+	sort_keys(keys)
+	entries := new_lox_map()
+	for _, key := range keys {
+		entries.store(key, values[key])
+	}
+	return entries
+}
+
+func map_to_go(entries *LoxMap, target reflect.Type) (reflect.Value, error) {
+	result := reflect.MakeMapWithSize(target, len(entries.entries))
+	for _, entry := range entries.entries {
+		key, err := to_go(entry.key, target.Key())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("key %s: %v", stringify_nested(entry.key, nil), err)
+		}
+		value, err := to_go(entry.value, target.Elem())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("value for key %s: %v", stringify_nested(entry.key, nil), err)
+		}
+		result.SetMapIndex(key, value)
+	}
+	return result, nil
+}
+
+func check_integer(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) {
+		return errors.New("expected an integer but got " + stringify(f))
+	}
+	return nil
+}
+
+// type_name describes the type of a Lox value for error messages.
+func type_name(val Value) string {
+	switch t := val.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case LoxInstance:
+		return t.klass.name + " instance"
+	case *LoxList:
+		return "list"
+	case *LoxMap:
+		return "map"
+	case *LoxError:
+		return "error"
+	case *Module:
+		return "module"
+	case LoxClass, GoClass:
+		return "class"
+	case LoxCallable:
+		return "function"
+	case GoInstance:
+		return t.value.Type().String()
+	}
+	return fmt.Sprintf("%T", val)
+}
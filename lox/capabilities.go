@@ -0,0 +1,287 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// capability_natives lists the natives of every capability module, so
+// that the ones an interpreter was not granted can be reported as denied
+// rather than undefined.
+var capability_natives = map[string][]string{
+	"clock":   {"clock"},
+	"fs":      {"readFile", "writeFile", "fileExists", "listDir"},
+	"env":     {"getenv"},
+	"process": {"exec"},
+}
+
+// Capability is a module of natives that an interpreter may be granted
+// with WithCapabilities, such as the clock or access to files.
+type Capability struct {
+	name    string
+	natives map[string]Value
+	// denied holds the natives of the module held back by its settings,
+	// with the reason given when a script uses one.
+	denied map[string]string
+}
+
+// FileAccess tells whether scripts granted AllowFiles may change files.
+type FileAccess int
+
+const (
+	ReadOnly FileAccess = iota
+	ReadWrite
+)
+
+// WithCapabilities grants scripts the given capability modules, and no
+// others. Without this option an interpreter is granted AllowClock only.
+// Natives that are not granted are left out of the globals, and a script
+// that uses one gets a permission error instead of an undefined variable.
+func WithCapabilities(capabilities ...Capability) Option {
+	return func(interp *Interpreter) {
+		interp.capabilities = append([]Capability{}, capabilities...)
+	}
+}
+
+// AllowClock grants clock(), the seconds since the Unix epoch as a number.
+func AllowClock() Capability {
+	return Capability{name: "clock", natives: map[string]Value{"clock": Clock{}}}
+}
+
+// AllowEnv grants getenv(name), which returns the value of an environment
+// variable, or nil when it is not set.
+func AllowEnv() Capability {
+	getenv := native_method{"getenv", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+		name, ok := arguments[0].(string)
+		if !ok {
+			return nil, errors.New("Variable name must be a string.")
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, nil
+		}
+		if err := interp.allocate(&interp.memory.Strings, string_size+len(value)); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}}
+	return Capability{name: "env", natives: map[string]Value{"getenv": getenv}}
+}
+
+// AllowProcess grants exec(program, arguments), which runs program with a
+// list of string arguments and returns what it wrote to stdout. The
+// program is not confined to the root given to AllowFiles.
+func AllowProcess() Capability {
+	run := native_method{"exec", 2, func(interp *Interpreter, arguments []Value) (Value, error) {
+		program, ok := arguments[0].(string)
+		if !ok {
+			return nil, errors.New("Program must be a string.")
+		}
+		list, ok := arguments[1].(*LoxList)
+		if !ok {
+			return nil, errors.New("Arguments must be a list of strings.")
+		}
+		args := make([]string, len(list.elements))
+		for i, element := range list.elements {
+			if args[i], ok = element.(string); !ok {
+				return nil, errors.New("Arguments must be a list of strings.")
+			}
+		}
+		output, err := exec.CommandContext(interp.ctx, program, args...).Output()
+		if err != nil {
+			if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+				return nil, fmt.Errorf("%s: %s", program, strings.TrimSpace(string(exit.Stderr)))
+			}
+			return nil, fmt.Errorf("%s: %v", program, err)
+		}
+		if err := interp.allocate(&interp.memory.Strings, string_size+len(output)); err != nil {
+			return nil, err
+		}
+		return string(output), nil
+	}}
+	return Capability{name: "process", natives: map[string]Value{"exec": run}}
+}
+
+// AllowFiles grants the file natives, confined to the directory root:
+// readFile(path), fileExists(path) and listDir(path), and with ReadWrite
+// access writeFile(path, text). Relative paths are resolved against root,
+// and paths leading outside of it, symbolic links included, are refused.
+func AllowFiles(root string, access FileAccess) Capability {
+	sandbox := file_sandbox{root}
+	if abs, err := filepath.Abs(root); err == nil {
+		sandbox.root = abs
+	}
+	if real, err := filepath.EvalSymlinks(sandbox.root); err == nil {
+		sandbox.root = real
+	}
+	natives := map[string]Value{
+		"readFile": native_method{"readFile", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+			path, err := sandbox.resolve(arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			bytes, err := os.ReadFile(path)
+			if err != nil {
+				return nil, file_error(err, arguments[0].(string))
+			}
+			if err := interp.allocate(&interp.memory.Strings, string_size+len(bytes)); err != nil {
+				return nil, err
+			}
+			return string(bytes), nil
+		}},
+		"fileExists": native_method{"fileExists", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+			path, err := sandbox.resolve(arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			_, err = os.Stat(path)
+			return err == nil, nil
+		}},
+		"listDir": native_method{"listDir", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+			path, err := sandbox.resolve(arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, file_error(err, arguments[0].(string))
+			}
+			names := make([]Value, len(entries))
+			bytes := list_size
+			for i, entry := range entries {
+				names[i] = entry.Name()
+				bytes += element_size + string_size + len(entry.Name())
+			}
+			if err := interp.allocate(&interp.memory.Collections, bytes); err != nil {
+				return nil, err
+			}
+			return &LoxList{names}, nil
+		}},
+	}
+	write := native_method{"writeFile", 2, func(interp *Interpreter, arguments []Value) (Value, error) {
+		path, err := sandbox.resolve(arguments[0])
+		if err != nil {
+			return nil, err
+		}
+		text, ok := arguments[1].(string)
+		if !ok {
+			return nil, errors.New("File contents must be a string.")
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return nil, file_error(err, arguments[0].(string))
+		}
+		return nil, nil
+	}}
+	if access == ReadWrite {
+		natives["writeFile"] = write
+		return Capability{name: "fs", natives: natives}
+	}
+	return Capability{"fs", natives, map[string]string{"writeFile": "files are read-only"}}
+}
+
+// file_sandbox confines paths to its root directory.
+type file_sandbox struct {
+	root string
+}
+
+// resolve returns the path that argument names, or a permission error
+// when it is outside of the root.
+func (fs file_sandbox) resolve(argument Value) (string, error) {
+	path, ok := argument.(string)
+	if !ok {
+		return "", errors.New("Path must be a string.")
+	}
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(fs.root, full)
+	}
+	full = filepath.Clean(full)
+	outside := fmt.Errorf("Permission denied: '%s' is outside of the file sandbox.", path)
+	if !fs.contains(full) {
+		return "", outside
+	}
+	if full == fs.root {
+		return full, nil
+	}
+	// Follow the links of the directory, which must exist, so that a link
+	// inside the root cannot lead out of it. A link in the last component
+	// must lead to an existing file in the root: writing through a
+	// dangling link would create its target, wherever that is.
+	dir, err := filepath.EvalSymlinks(filepath.Dir(full))
+	if err != nil {
+		return "", file_error(err, path)
+	}
+	real := filepath.Join(dir, filepath.Base(full))
+	if !fs.contains(real) {
+		return "", outside
+	}
+	info, err := os.Lstat(real)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(real)
+		if err != nil {
+			return "", fmt.Errorf("Permission denied: '%s' is a link to a missing file.", path)
+		}
+		if !fs.contains(target) {
+			return "", outside
+		}
+		real = target
+	}
+	return real, nil
+}
+
+// contains reports whether path, which must be clean and absolute, is the
+// root or inside of it.
+func (fs file_sandbox) contains(path string) bool {
+	rel, err := filepath.Rel(fs.root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// file_error strips the Go operation name and the host path from errors
+// of the os package, naming the file by path, as the script passed it.
+func file_error(err error, path string) error {
+	if path_err, ok := err.(*os.PathError); ok {
+		return fmt.Errorf("%s: %v", path, path_err.Err)
+	}
+	return err
+}
+
+// grant defines the natives of the granted capabilities in the builtins,
+// and records why each native left out of them is denied.
+func (interp *Interpreter) grant() {
+	if interp.capabilities == nil {
+		interp.capabilities = []Capability{AllowClock()}
+	}
+	interp.denied = make(map[string]string)
+	for module, names := range capability_natives {
+		for _, name := range names {
+			interp.denied[name] = fmt.Sprintf("'%s' needs the %s capability", name, module)
+		}
+	}
+	for _, capability := range interp.capabilities {
+		for name, reason := range capability.denied {
+			interp.denied[name] = fmt.Sprintf("'%s' is not allowed: %s", name, reason)
+		}
+	}
+	for _, capability := range interp.capabilities {
+		for name, native := range capability.natives {
+			interp.builtins.define(name, native)
+			delete(interp.denied, name)
+		}
+	}
+}
+
+// get_global looks name up in the globals env, reporting a native that
+// was not granted as a permission error.
+func (interp *Interpreter) get_global(env *Environment, name Token) (Value, error) {
+	value, err := env.get(name)
+	if err != nil {
+		if reason, ok := interp.denied[name.lexeme]; ok {
+			return nil, RuntimeError{"Permission denied: " + reason + ".", name}
+		}
+	}
+	return value, err
+}
@@ -0,0 +1,136 @@
+package lox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sandbox_dirs creates a root directory holding a.txt, and beside it an
+// outside directory holding secret.txt.
+func sandbox_dirs(t *testing.T) (string, string) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("inside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+// run_sandboxed runs source with read-write access to root, returning
+// what it printed and the error reported.
+func run_sandboxed(t *testing.T, root string, source string) (string, string) {
+	var stdout, stderr bytes.Buffer
+	interp := NewInterpreter(WithStdout(&stdout), WithStderr(&stderr), WithCapabilities(AllowFiles(root, ReadWrite)))
+	interp.Run(source)
+	return stdout.String(), stderr.String()
+}
+
+func TestFileSandboxResolve(t *testing.T) {
+	root, outside := sandbox_dirs(t)
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "out_file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out_dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "in_file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing.txt"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	fs := file_sandbox{root}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		fs.root = real
+	}
+	allowed := map[string]string{
+		"a.txt":                         filepath.Join(fs.root, "a.txt"),
+		"./a.txt":                       filepath.Join(fs.root, "a.txt"),
+		"new.txt":                       filepath.Join(fs.root, "new.txt"),
+		".":                             fs.root,
+		"in_file":                       filepath.Join(fs.root, "a.txt"),
+		filepath.Join(fs.root, "a.txt"): filepath.Join(fs.root, "a.txt"),
+	}
+	for path, want := range allowed {
+		got, err := fs.resolve(path)
+		if err != nil || got != want {
+			t.Errorf("resolve(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	denied := []string{
+		"..",
+		"../outside/secret.txt",
+		"sub/../../outside/secret.txt",
+		filepath.Join(outside, "secret.txt"),
+		"/etc/passwd",
+		"out_file",
+		"out_dir/secret.txt",
+		"dangling",
+	}
+	for _, path := range denied {
+		if got, err := fs.resolve(path); err == nil || !strings.HasPrefix(err.Error(), "Permission denied") {
+			t.Errorf("resolve(%q) = %q, %v; want a permission error", path, got, err)
+		}
+	}
+}
+
+func TestFileSandboxDanglingLinkWrite(t *testing.T) {
+	root, outside := sandbox_dirs(t)
+	target := filepath.Join(outside, "created.txt")
+	if err := os.Symlink(target, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr := run_sandboxed(t, root, `writeFile("link", "escaped");`)
+	if !strings.Contains(stderr, "Permission denied") {
+		t.Errorf("writeFile through a dangling link reported %q", stderr)
+	}
+	if _, err := os.Lstat(target); err == nil {
+		t.Errorf("writeFile through a dangling link created %s", target)
+	}
+}
+
+func TestFileSandboxErrors(t *testing.T) {
+	root, _ := sandbox_dirs(t)
+	stdout, stderr := run_sandboxed(t, root, `
+print readFile("a.txt");
+try { readFile("missing.txt"); } catch (e) { print e.message; }
+try { listDir("nowhere/deeper"); } catch (e) { print e.message; }
+writeFile("b.txt", "written");
+print readFile("b.txt");
+`)
+	want := "inside\nmissing.txt: no such file or directory\nnowhere/deeper: no such file or directory\nwritten\n"
+	if stdout != want || stderr != "" {
+		t.Errorf("got stdout %q and stderr %q, want %q", stdout, stderr, want)
+	}
+	if strings.Contains(stdout, root) {
+		t.Errorf("errors show the host path: %q", stdout)
+	}
+}
+
+func TestClockArithmetic(t *testing.T) {
+	for _, backend := range []Backend{TreeWalk, Bytecode} {
+		var stdout, stderr bytes.Buffer
+		interp := NewInterpreter(WithBackend(backend), WithStdout(&stdout), WithStderr(&stderr))
+		interp.Run(`
+var start = clock();
+var elapsed = clock() - start;
+print elapsed >= 0 and elapsed < 60;
+print start / 60 / 60 / 24 / 365 > 50;
+`)
+		if want := "true\ntrue\n"; stdout.String() != want || stderr.Len() != 0 {
+			t.Errorf("backend %d: got stdout %q and stderr %q, want %q", backend, stdout.String(), stderr.String(), want)
+		}
+	}
+}
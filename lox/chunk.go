@@ -0,0 +1,168 @@
+package lox
+
+type OpCode byte
+
+// Operands follow the opcode in the instruction stream. Constant and jump
+// operands take two bytes, big endian; slots and counts take one.
+const (
+	OP_CONSTANT OpCode = iota
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_DEFINE_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_GET_PROPERTY
+	OP_SET_PROPERTY
+	OP_GET_SUPER
+	OP_GET_INDEX
+	OP_SET_INDEX
+	OP_LIST
+	OP_MAP
+	OP_EQUAL
+	OP_NOT_EQUAL
+	OP_GREATER
+	OP_GREATER_EQUAL
+	OP_LESS
+	OP_LESS_EQUAL
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_PRINT
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_CLOSURE
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_IMPORT
+	OP_TRY
+	OP_END_TRY
+	OP_THROW
+	OP_RETHROW
+	OP_CLASS
+	OP_SUPERCLASS
+	OP_METHOD
+)
+
+var op_names = [...]string{
+	OP_CONSTANT:      "OP_CONSTANT",
+	OP_NIL:           "OP_NIL",
+	OP_TRUE:          "OP_TRUE",
+	OP_FALSE:         "OP_FALSE",
+	OP_POP:           "OP_POP",
+	OP_GET_LOCAL:     "OP_GET_LOCAL",
+	OP_SET_LOCAL:     "OP_SET_LOCAL",
+	OP_GET_GLOBAL:    "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL: "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL:    "OP_SET_GLOBAL",
+	OP_GET_UPVALUE:   "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:   "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:  "OP_GET_PROPERTY",
+	OP_SET_PROPERTY:  "OP_SET_PROPERTY",
+	OP_GET_SUPER:     "OP_GET_SUPER",
+	OP_GET_INDEX:     "OP_GET_INDEX",
+	OP_SET_INDEX:     "OP_SET_INDEX",
+	OP_LIST:          "OP_LIST",
+	OP_MAP:           "OP_MAP",
+	OP_EQUAL:         "OP_EQUAL",
+	OP_NOT_EQUAL:     "OP_NOT_EQUAL",
+	OP_GREATER:       "OP_GREATER",
+	OP_GREATER_EQUAL: "OP_GREATER_EQUAL",
+	OP_LESS:          "OP_LESS",
+	OP_LESS_EQUAL:    "OP_LESS_EQUAL",
+	OP_ADD:           "OP_ADD",
+	OP_SUBTRACT:      "OP_SUBTRACT",
+	OP_MULTIPLY:      "OP_MULTIPLY",
+	OP_DIVIDE:        "OP_DIVIDE",
+	OP_NOT:           "OP_NOT",
+	OP_NEGATE:        "OP_NEGATE",
+	OP_PRINT:         "OP_PRINT",
+	OP_JUMP:          "OP_JUMP",
+	OP_JUMP_IF_FALSE: "OP_JUMP_IF_FALSE",
+	OP_LOOP:          "OP_LOOP",
+	OP_CALL:          "OP_CALL",
+	OP_CLOSURE:       "OP_CLOSURE",
+	OP_CLOSE_UPVALUE: "OP_CLOSE_UPVALUE",
+	OP_RETURN:        "OP_RETURN",
+	OP_IMPORT:        "OP_IMPORT",
+	OP_TRY:           "OP_TRY",
+	OP_END_TRY:       "OP_END_TRY",
+	OP_THROW:         "OP_THROW",
+	OP_RETHROW:       "OP_RETHROW",
+	OP_CLASS:         "OP_CLASS",
+	OP_SUPERCLASS:    "OP_SUPERCLASS",
+	OP_METHOD:        "OP_METHOD",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(op_names) {
+		return op_names[op]
+	}
+	return "OP_UNKNOWN"
+}
+
+// Chunk is a compiled sequence of instructions. lines holds the source
+// line of every byte in code. accesses describes the variable read or
+// written by each variable instruction, keyed by its offset.
+type Chunk struct {
+	code      []byte
+	constants []Value
+	lines     []int
+	accesses  map[int]Access
+}
+
+// Access names the variable touched by an instruction, along with the
+// scope depth the resolver assigned it: -1 for globals and no_depth for
+// accesses the compiler generated itself.
+type Access struct {
+	name  string
+	depth int
+}
+
+// note_access records that the next instruction written touches name.
+func (ch *Chunk) note_access(name string, depth int) {
+	if ch.accesses == nil {
+		ch.accesses = make(map[int]Access)
+	}
+	ch.accesses[len(ch.code)] = Access{name, depth}
+}
+
+func (ch *Chunk) write(b byte, line int) {
+	ch.code = append(ch.code, b)
+	ch.lines = append(ch.lines, line)
+}
+
+func (ch *Chunk) add_constant(value Value) int {
+	ch.constants = append(ch.constants, value)
+	return len(ch.constants) - 1
+}
+
+func (ch Chunk) read_short(offset int) int {
+	return int(ch.code[offset])<<8 | int(ch.code[offset+1])
+}
+
+// Function is the compiled form of a Lox function or of a whole script.
+type Function struct {
+	name          string
+	n_params      int
+	upvalue_count int
+	chunk         Chunk
+	file          string
+}
+
+func (fn *Function) String() string {
+	if fn.name == "" {
+		return "<script>"
+	}
+	return "<fn " + fn.name + ">"
+}
@@ -1,27 +1,39 @@
-package main
+package lox
+
+// Method is a function stored in a class, either a tree-walker
+// LoxFunction or a compiled Closure, that can be bound to an instance.
+type Method interface {
+	LoxCallable
+	bind(instance LoxInstance) LoxCallable
+}
 
 type LoxClass struct {
 	name       string
 	superclass *LoxClass
-	methods    map[string]LoxFunction
+	methods    map[string]Method
 }
 
-func (lc LoxClass) find_method(name string) (LoxFunction, bool) {
+func (lc LoxClass) find_method(name string) (Method, bool) {
 	if md, ok := lc.methods[name]; ok {
 		return md, true
 	}
 	if lc.superclass != nil {
 		return lc.superclass.find_method(name)
 	}
-	return LoxFunction{}, false
+	return nil, false
 }
 
-func (lc LoxClass) call(arguments []Value) Value {
+func (lc LoxClass) call(interp *Interpreter, arguments []Value) (Value, error) {
+	if err := interp.allocate(&interp.memory.Instances, instance_size); err != nil {
+		return nil, err
+	}
 	instance := LoxInstance{lc, make(map[string]Value)}
 	if initializer, ok := lc.find_method("init"); ok {
-		initializer.bind(instance).call(arguments)
+		if _, err := initializer.bind(instance).call(interp, arguments); err != nil {
+			return nil, err
+		}
 	}
-	return instance
+	return instance, nil
 }
 
 func (lc LoxClass) arity() int {
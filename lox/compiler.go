@@ -0,0 +1,656 @@
+package lox
+
+// Local is a variable living in a stack slot of the function being
+// compiled.
+type Local struct {
+	name        string
+	depth       int
+	is_captured bool
+}
+
+// loop_state tracks the innermost loop being compiled so that break and
+// continue can jump out of its body.
+type loop_state struct {
+	scope_depth int
+	tries       int
+	breaks      []int
+	continues   []int
+}
+
+// try_state is an exception handler installed by the code being compiled.
+// Jumps and returns out of the try remove it and run finally inline.
+type try_state struct {
+	scope_depth int
+	finally     *Block
+}
+
+type upvalue_ref struct {
+	index    int
+	is_local bool
+}
+
+// Compiler lowers the resolved AST of one function into a Chunk. A new
+// Compiler is started for every nested function declaration.
+type Compiler struct {
+	interp      *Interpreter
+	enclosing   *Compiler
+	function    *Function
+	f_type      FunctionType
+	locals      []Local
+	upvalues    []upvalue_ref
+	loops       []*loop_state
+	tries       []try_state
+	scope_depth int
+	line        int
+}
+
+func new_compiler(interp *Interpreter, enclosing *Compiler, f_type FunctionType, name string) *Compiler {
+	cp := &Compiler{interp: interp, enclosing: enclosing, function: &Function{name: name}, f_type: f_type}
+	if enclosing != nil {
+		cp.line = enclosing.line
+	}
+	// Slot zero holds the callee, or the receiver inside methods.
+	slot_zero := ""
+	if f_type == METHOD || f_type == INITIALIZER {
+		slot_zero = "this"
+	}
+	cp.locals = append(cp.locals, Local{slot_zero, 0, false})
+	return cp
+}
+
+// compile lowers a resolved program into the function for its top level.
+func (interp *Interpreter) compile(statements []Stmt, file string) *Function {
+	cp := new_compiler(interp, nil, NONE, "")
+	cp.function.file = file
+	cp.compile_stmts(statements)
+	cp.emit_return()
+	return cp.function
+}
+
+func (cp *Compiler) compile_stmts(statements []Stmt) {
+	for _, stmt := range statements {
+		cp.compile_stmt(stmt)
+	}
+}
+
+func (cp *Compiler) compile_stmt(stmt Stmt) {
+	// Code that no token places, such as a literal condition, belongs to
+	// the line of its statement, as in the tree-walker. Statements made up
+	// by desugaring have no span and keep the line of their enclosing one.
+	if line := stmt.span().start.line; line > 0 {
+		cp.line = line
+	}
+	switch t := stmt.(type) {
+	case Print:
+		cp.compile_expr(t.expr)
+		cp.emit_op(OP_PRINT)
+	case Expression:
+		cp.compile_expr(t.expr)
+		if cp.interp.in_repl {
+			cp.emit_op(OP_PRINT)
+		} else {
+			cp.emit_op(OP_POP)
+		}
+	case Var:
+		cp.line = t.name.line
+		cp.declare_variable(t.name)
+		if t.initializer != nil {
+			cp.compile_expr(t.initializer)
+		} else {
+			cp.emit_op(OP_NIL)
+		}
+		cp.define_variable(t.name)
+	case Block:
+		cp.begin_scope()
+		cp.compile_stmts(t.statements)
+		cp.end_scope()
+	case If:
+		cp.compile_expr(t.condition)
+		then_jump := cp.emit_jump(OP_JUMP_IF_FALSE)
+		cp.emit_op(OP_POP)
+		cp.compile_stmt(t.then_branch)
+		else_jump := cp.emit_jump(OP_JUMP)
+		cp.patch_jump(then_jump)
+		cp.emit_op(OP_POP)
+		if t.else_branch != nil {
+			cp.compile_stmt(t.else_branch)
+		}
+		cp.patch_jump(else_jump)
+	case While:
+		loop_start := len(cp.function.chunk.code)
+		cp.compile_expr(t.condition)
+		exit_jump := cp.emit_jump(OP_JUMP_IF_FALSE)
+		cp.emit_op(OP_POP)
+		loop := &loop_state{scope_depth: cp.scope_depth, tries: len(cp.tries)}
+		cp.loops = append(cp.loops, loop)
+		cp.compile_stmt(t.body)
+		cp.loops = cp.loops[:len(cp.loops)-1]
+		for _, jump := range loop.continues {
+			cp.patch_jump(jump)
+		}
+		if t.increment != nil {
+			cp.compile_expr(t.increment)
+			cp.emit_op(OP_POP)
+		}
+		cp.emit_loop(loop_start)
+		cp.patch_jump(exit_jump)
+		cp.emit_op(OP_POP)
+		for _, jump := range loop.breaks {
+			cp.patch_jump(jump)
+		}
+	case Break:
+		cp.line = t.keyword.line
+		loop := cp.loops[len(cp.loops)-1]
+		cp.unwind_tries(loop.tries)
+		cp.discard_locals(loop.scope_depth)
+		loop.breaks = append(loop.breaks, cp.emit_jump(OP_JUMP))
+	case Continue:
+		cp.line = t.keyword.line
+		loop := cp.loops[len(cp.loops)-1]
+		cp.unwind_tries(loop.tries)
+		cp.discard_locals(loop.scope_depth)
+		loop.continues = append(loop.continues, cp.emit_jump(OP_JUMP))
+	case Func:
+		cp.line = t.name.line
+		cp.declare_variable(t.name)
+		cp.compile_function(t, FUNCTION)
+		cp.define_variable(t.name)
+	case Return:
+		cp.line = t.keyword.line
+		if t.value == nil {
+			cp.emit_return_value()
+		} else {
+			cp.compile_expr(t.value)
+		}
+		if len(cp.tries) > 0 {
+			// The return value waits in a hidden slot while finally runs.
+			cp.begin_scope()
+			cp.add_local("")
+			cp.unwind_tries(0)
+			cp.locals = cp.locals[:len(cp.locals)-1]
+			cp.scope_depth--
+		}
+		cp.emit_op(OP_RETURN)
+	case Import:
+		cp.line = t.keyword.line
+		cp.declare_variable(t.name)
+		cp.emit_op(OP_IMPORT)
+		cp.emit_short(cp.make_constant(t.path))
+		cp.emit_short(cp.make_constant(t.file))
+		cp.define_variable(t.name)
+	case Throw:
+		cp.line = t.keyword.line
+		cp.compile_expr(t.value)
+		cp.emit_op(OP_THROW)
+	case Try:
+		cp.compile_try(t)
+	case Class:
+		cp.compile_class(t)
+	}
+}
+
+// compile_try installs a handler for the catch clause around the body and
+// another for the finally clause around both. The finally handler runs the
+// clause and then rethrows the error it caught.
+func (cp *Compiler) compile_try(stmt Try) {
+	var finally_handler, catch_handler int
+	if stmt.finally != nil {
+		finally_handler = cp.emit_try(true)
+		cp.tries = append(cp.tries, try_state{cp.scope_depth, stmt.finally})
+	}
+	if stmt.catch != nil {
+		catch_handler = cp.emit_try(false)
+		cp.tries = append(cp.tries, try_state{cp.scope_depth, nil})
+	}
+	cp.compile_stmt(stmt.body)
+	if stmt.catch != nil {
+		cp.tries = cp.tries[:len(cp.tries)-1]
+		cp.emit_op(OP_END_TRY)
+		skip := cp.emit_jump(OP_JUMP)
+		cp.patch_jump(catch_handler)
+		cp.line = stmt.catch.name.line
+		cp.begin_scope()
+		cp.add_local(stmt.catch.name.lexeme)
+		cp.compile_stmts(stmt.catch.body)
+		cp.end_scope()
+		cp.patch_jump(skip)
+	}
+	if stmt.finally != nil {
+		cp.tries = cp.tries[:len(cp.tries)-1]
+		cp.emit_op(OP_END_TRY)
+		cp.compile_stmt(*stmt.finally)
+		skip := cp.emit_jump(OP_JUMP)
+		cp.patch_jump(finally_handler)
+		cp.begin_scope()
+		cp.add_local("")
+		cp.compile_stmt(*stmt.finally)
+		cp.emit_op(OP_RETHROW)
+		cp.locals = cp.locals[:len(cp.locals)-1]
+		cp.scope_depth--
+		cp.patch_jump(skip)
+	}
+}
+
+// unwind_tries emits the code that leaves the try statements nested deeper
+// than depth, innermost first, before a jump or return out of them.
+func (cp *Compiler) unwind_tries(depth int) {
+	tries := cp.tries
+	for i := len(tries) - 1; i >= depth; i-- {
+		cp.emit_op(OP_END_TRY)
+		if tries[i].finally == nil {
+			continue
+		}
+		// Locals declared inside the try must not shadow the names used
+		// by the finally clause, so they are hidden while it compiles.
+		hidden := make(map[int]string)
+		for j := len(cp.locals) - 1; j >= 0 && cp.locals[j].depth > tries[i].scope_depth; j-- {
+			hidden[j] = cp.locals[j].name
+			cp.locals[j].name = ""
+		}
+		cp.tries = tries[:i]
+		cp.compile_stmt(*tries[i].finally)
+		for j, name := range hidden {
+			cp.locals[j].name = name
+		}
+	}
+	cp.tries = tries
+}
+
+func (cp *Compiler) compile_class(class Class) {
+	cp.line = class.name.line
+	name_constant := cp.identifier_constant(class.name.lexeme)
+	cp.declare_variable(class.name)
+	has_superclass := class.superclass != nil
+	if has_superclass {
+		cp.named_variable(class.superclass.name, cp.depth_of(class.superclass), false)
+	}
+	cp.emit_op(OP_CLASS)
+	cp.emit_short(name_constant)
+	if has_superclass {
+		cp.emit_byte(1)
+	} else {
+		cp.emit_byte(0)
+	}
+	cp.define_variable(class.name)
+	if has_superclass {
+		cp.begin_scope()
+		cp.named_variable(class.name, no_depth, false)
+		cp.emit_op(OP_SUPERCLASS)
+		cp.add_local("super")
+	}
+	cp.named_variable(class.name, no_depth, false)
+	for _, method := range class.methods {
+		f_type := METHOD
+		if method.name.lexeme == "init" {
+			f_type = INITIALIZER
+		}
+		cp.compile_function(method, f_type)
+		cp.line = method.name.line
+		cp.emit_op(OP_METHOD)
+		cp.emit_short(cp.identifier_constant(method.name.lexeme))
+	}
+	cp.emit_op(OP_POP)
+	if has_superclass {
+		cp.end_scope()
+	}
+}
+
+func (cp *Compiler) compile_function(declaration Func, f_type FunctionType) {
+	fc := new_compiler(cp.interp, cp, f_type, declaration.name.lexeme)
+	fc.function.file = declaration.file
+	fc.begin_scope()
+	for _, param := range declaration.params {
+		fc.declare_variable(param)
+	}
+	fc.function.n_params = len(declaration.params)
+	fc.compile_stmts(declaration.body)
+	fc.emit_return()
+	fc.function.upvalue_count = len(fc.upvalues)
+
+	cp.emit_op(OP_CLOSURE)
+	cp.emit_short(cp.make_constant(fc.function))
+	for _, uv := range fc.upvalues {
+		if uv.is_local {
+			cp.emit_byte(1)
+		} else {
+			cp.emit_byte(0)
+		}
+		cp.emit_byte(byte(uv.index))
+	}
+}
+
+func (cp *Compiler) compile_expr(expr Expr) {
+	switch t := expr.(type) {
+	case *Literal:
+		switch value := t.value.(type) {
+		case nil:
+			cp.emit_op(OP_NIL)
+		case bool:
+			if value {
+				cp.emit_op(OP_TRUE)
+			} else {
+				cp.emit_op(OP_FALSE)
+			}
+		default:
+			cp.emit_op(OP_CONSTANT)
+			cp.emit_short(cp.make_constant(value))
+		}
+	case *Grouping:
+		cp.compile_expr(t.expression)
+	case *Unary:
+		cp.compile_expr(t.right)
+		cp.line = t.operator.line
+		if t.operator.t_type == MINUS {
+			cp.emit_op(OP_NEGATE)
+		} else {
+			cp.emit_op(OP_NOT)
+		}
+	case *Binary:
+		cp.compile_expr(t.left)
+		cp.compile_expr(t.right)
+		cp.line = t.operator.line
+		cp.emit_op(binary_ops[t.operator.t_type])
+	case *Logical:
+		cp.compile_expr(t.left)
+		if t.operator.t_type == AND {
+			end_jump := cp.emit_jump(OP_JUMP_IF_FALSE)
+			cp.emit_op(OP_POP)
+			cp.compile_expr(t.right)
+			cp.patch_jump(end_jump)
+		} else {
+			else_jump := cp.emit_jump(OP_JUMP_IF_FALSE)
+			end_jump := cp.emit_jump(OP_JUMP)
+			cp.patch_jump(else_jump)
+			cp.emit_op(OP_POP)
+			cp.compile_expr(t.right)
+			cp.patch_jump(end_jump)
+		}
+	case *Variable:
+		cp.named_variable(t.name, cp.depth_of(t), false)
+	case *Assign:
+		cp.compile_expr(t.value)
+		cp.named_variable(t.name, cp.depth_of(t), true)
+	case *Call:
+		cp.compile_expr(t.callee)
+		for _, arg := range t.arguments {
+			cp.compile_expr(arg)
+		}
+		cp.line = t.paren.line
+		cp.emit_op(OP_CALL)
+		cp.emit_byte(byte(len(t.arguments)))
+	case *Get:
+		cp.compile_expr(t.object)
+		cp.line = t.name.line
+		cp.emit_op(OP_GET_PROPERTY)
+		cp.emit_short(cp.identifier_constant(t.name.lexeme))
+	case *Set:
+		cp.compile_expr(t.object)
+		cp.compile_expr(t.value)
+		cp.line = t.name.line
+		cp.emit_op(OP_SET_PROPERTY)
+		cp.emit_short(cp.identifier_constant(t.name.lexeme))
+	case *Lambda:
+		cp.compile_function(t.function, FUNCTION)
+	case *List:
+		for _, element := range t.elements {
+			cp.compile_expr(element)
+		}
+		cp.line = t.bracket.line
+		cp.emit_op(OP_LIST)
+		cp.emit_short(len(t.elements))
+	case *Map:
+		for i := range t.keys {
+			cp.compile_expr(t.keys[i])
+			cp.compile_expr(t.values[i])
+		}
+		cp.line = t.brace.line
+		cp.emit_op(OP_MAP)
+		cp.emit_short(len(t.keys))
+	case *Index:
+		cp.compile_expr(t.object)
+		cp.compile_expr(t.index)
+		cp.line = t.bracket.line
+		cp.emit_op(OP_GET_INDEX)
+	case *SetIndex:
+		cp.compile_expr(t.object)
+		cp.compile_expr(t.index)
+		cp.compile_expr(t.value)
+		cp.line = t.bracket.line
+		cp.emit_op(OP_SET_INDEX)
+	case *This:
+		cp.named_variable(t.keyword, cp.depth_of(t), false)
+	case *Super:
+		depth := cp.depth_of(t)
+		cp.named_variable(Token{THIS, "this", nil, t.keyword.line, t.keyword.span}, depth-1, false)
+		cp.named_variable(Token{SUPER, "super", nil, t.keyword.line, t.keyword.span}, depth, false)
+		cp.line = t.method.line
+		cp.emit_op(OP_GET_SUPER)
+		cp.emit_short(cp.identifier_constant(t.method.lexeme))
+	}
+}
+
+var binary_ops = map[TokenType]OpCode{
+	PLUS:          OP_ADD,
+	MINUS:         OP_SUBTRACT,
+	STAR:          OP_MULTIPLY,
+	SLASH:         OP_DIVIDE,
+	GREATER:       OP_GREATER,
+	GREATER_EQUAL: OP_GREATER_EQUAL,
+	LESS:          OP_LESS,
+	LESS_EQUAL:    OP_LESS_EQUAL,
+	EQUAL_EQUAL:   OP_EQUAL,
+	BANG_EQUAL:    OP_NOT_EQUAL,
+}
+
+// no_depth marks variable accesses the compiler generates itself, which
+// the resolver never saw.
+const no_depth = -2
+
+// depth_of returns the scope depth the resolver found for expr, or -1 if
+// it refers to a global.
+func (cp *Compiler) depth_of(expr Expr) int {
+	if depth, ok := cp.interp.locals[expr]; ok {
+		return depth
+	}
+	return -1
+}
+
+func (cp *Compiler) named_variable(name Token, depth int, assign bool) {
+	cp.line = name.line
+	cp.function.chunk.note_access(name.lexeme, depth)
+	if slot := cp.resolve_local(name.lexeme); slot != -1 {
+		if assign {
+			cp.emit_op(OP_SET_LOCAL)
+		} else {
+			cp.emit_op(OP_GET_LOCAL)
+		}
+		cp.emit_byte(byte(slot))
+	} else if index := cp.resolve_upvalue(name.lexeme); index != -1 {
+		if assign {
+			cp.emit_op(OP_SET_UPVALUE)
+		} else {
+			cp.emit_op(OP_GET_UPVALUE)
+		}
+		cp.emit_byte(byte(index))
+	} else {
+		if assign {
+			cp.emit_op(OP_SET_GLOBAL)
+		} else {
+			cp.emit_op(OP_GET_GLOBAL)
+		}
+		cp.emit_short(cp.identifier_constant(name.lexeme))
+	}
+}
+
+func (cp *Compiler) resolve_local(name string) int {
+	for i := len(cp.locals) - 1; i >= 0; i-- {
+		if cp.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (cp *Compiler) resolve_upvalue(name string) int {
+	if cp.enclosing == nil {
+		return -1
+	}
+	if local := cp.enclosing.resolve_local(name); local != -1 {
+		cp.enclosing.locals[local].is_captured = true
+		return cp.add_upvalue(local, true)
+	}
+	if upvalue := cp.enclosing.resolve_upvalue(name); upvalue != -1 {
+		return cp.add_upvalue(upvalue, false)
+	}
+	return -1
+}
+
+func (cp *Compiler) add_upvalue(index int, is_local bool) int {
+	for i, uv := range cp.upvalues {
+		if uv.index == index && uv.is_local == is_local {
+			return i
+		}
+	}
+	if len(cp.upvalues) == 256 {
+		cp.error("Too many closure variables in function")
+		return 0
+	}
+	cp.upvalues = append(cp.upvalues, upvalue_ref{index, is_local})
+	return len(cp.upvalues) - 1
+}
+
+func (cp *Compiler) declare_variable(name Token) {
+	if cp.scope_depth == 0 {
+		return
+	}
+	cp.add_local(name.lexeme)
+}
+
+func (cp *Compiler) add_local(name string) {
+	if len(cp.locals) == 256 {
+		cp.error("Too many local variables in function")
+		return
+	}
+	cp.locals = append(cp.locals, Local{name, cp.scope_depth, false})
+}
+
+func (cp *Compiler) define_variable(name Token) {
+	if cp.scope_depth > 0 {
+		return
+	}
+	cp.function.chunk.note_access(name.lexeme, -1)
+	cp.emit_op(OP_DEFINE_GLOBAL)
+	cp.emit_short(cp.identifier_constant(name.lexeme))
+}
+
+func (cp *Compiler) begin_scope() {
+	cp.scope_depth++
+}
+
+func (cp *Compiler) end_scope() {
+	cp.scope_depth--
+	n := cp.discard_locals(cp.scope_depth)
+	cp.locals = cp.locals[:len(cp.locals)-n]
+}
+
+// discard_locals emits the code that pops the locals declared deeper than
+// depth and returns how many there are. The compiler keeps tracking them,
+// since a jump out of a loop leaves the rest of the scope to compile.
+func (cp *Compiler) discard_locals(depth int) int {
+	n := 0
+	for i := len(cp.locals) - 1; i >= 0 && cp.locals[i].depth > depth; i-- {
+		if cp.locals[i].is_captured {
+			cp.emit_op(OP_CLOSE_UPVALUE)
+		} else {
+			cp.emit_op(OP_POP)
+		}
+		n++
+	}
+	return n
+}
+
+func (cp *Compiler) emit_byte(b byte) {
+	cp.function.chunk.write(b, cp.line)
+}
+
+func (cp *Compiler) emit_op(op OpCode) {
+	cp.emit_byte(byte(op))
+}
+
+func (cp *Compiler) emit_short(n int) {
+	cp.emit_byte(byte(n >> 8))
+	cp.emit_byte(byte(n))
+}
+
+func (cp *Compiler) emit_return() {
+	cp.emit_return_value()
+	cp.emit_op(OP_RETURN)
+}
+
+// emit_return_value pushes the value returned when a function does not
+// give one: the instance for initializers and nil otherwise.
+func (cp *Compiler) emit_return_value() {
+	if cp.f_type == INITIALIZER {
+		cp.emit_op(OP_GET_LOCAL)
+		cp.emit_byte(0)
+	} else {
+		cp.emit_op(OP_NIL)
+	}
+}
+
+func (cp *Compiler) emit_jump(op OpCode) int {
+	cp.emit_op(op)
+	cp.emit_short(0xffff)
+	return len(cp.function.chunk.code) - 2
+}
+
+// emit_try emits an OP_TRY whose handler offset is patched like a jump.
+func (cp *Compiler) emit_try(finally bool) int {
+	offset := cp.emit_jump(OP_TRY)
+	if finally {
+		cp.emit_byte(1)
+	} else {
+		cp.emit_byte(0)
+	}
+	return offset
+}
+
+func (cp *Compiler) patch_jump(offset int) {
+	jump := len(cp.function.chunk.code) - offset - 2
+	if jump > 0xffff {
+		cp.error("Too much code to jump over")
+	}
+	cp.function.chunk.code[offset] = byte(jump >> 8)
+	cp.function.chunk.code[offset+1] = byte(jump)
+}
+
+func (cp *Compiler) emit_loop(loop_start int) {
+	cp.emit_op(OP_LOOP)
+	offset := len(cp.function.chunk.code) - loop_start + 2
+	if offset > 0xffff {
+		cp.error("Loop body too large")
+	}
+	cp.emit_short(offset)
+}
+
+func (cp *Compiler) make_constant(value Value) int {
+	index := cp.function.chunk.add_constant(value)
+	if index > 0xffff {
+		cp.error("Too many constants in one chunk")
+		return 0
+	}
+	return index
+}
+
+func (cp *Compiler) identifier_constant(name string) int {
+	for i, constant := range cp.function.chunk.constants {
+		if s, ok := constant.(string); ok && s == name {
+			return i
+		}
+	}
+	return cp.make_constant(name)
+}
+
+func (cp *Compiler) error(message string) {
+	cp.interp.line_error(cp.line, code_compiler_limit, message)
+}
@@ -0,0 +1,474 @@
+package lox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// The debug adapter runs a single program on a single thread.
+const dap_thread = 1
+
+type dap_request struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dap_source struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dap_variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// dap_scope is the local variables of a frame, which are those of every
+// environment between it and the globals, or the globals themselves.
+type dap_scope struct {
+	env    *Environment
+	global bool
+}
+
+// dap_server is a debug adapter speaking the Debug Adapter Protocol. The
+// program runs in its own goroutine and waits on resume whenever it stops.
+// Requests for the state of the program are only answered while it is
+// stopped, and their answers stay valid until it resumes.
+type dap_server struct {
+	in      *bufio.Reader
+	out     io.Writer
+	interp  *Interpreter
+	db      *debugger
+	program string
+	// launched and configured record the launch and configurationDone
+	// requests, which must both arrive before the program starts.
+	launched   bool
+	configured bool
+	running    bool
+	one_based  bool
+	write_lock sync.Mutex
+	seq        int
+	resume     chan debug_action
+	done       chan struct{}
+	// mutex guards the state of the stopped program below.
+	mutex   sync.Mutex
+	stop    *debug_event
+	frames  []debug_frame
+	handles []any
+}
+
+// ServeDAP runs a debug adapter speaking the Debug Adapter Protocol on in
+// and out until the client disconnects. A launch request names the script
+// to debug in its program argument, and stopOnEntry stops it before its
+// first line. The script runs on the TreeWalk backend, and its output is
+// sent to the client as output events.
+func ServeDAP(in io.Reader, out io.Writer) error {
+	server := &dap_server{in: bufio.NewReader(in), out: out, one_based: true, resume: make(chan debug_action), done: make(chan struct{})}
+	server.interp = NewInterpreter(WithStdout(dap_output{server, "stdout"}), WithStderr(dap_output{server, "stderr"}))
+	server.db = new_debugger(server.interp, server, false)
+	server.interp.debugger = server.db
+	for {
+		body, err := read_message(server.in)
+		if err == io.EOF {
+			server.end()
+			return nil
+		}
+		if err != nil {
+			server.end()
+			return err
+		}
+		var request dap_request
+		if err := json.Unmarshal(body, &request); err != nil {
+			continue
+		}
+		result, err := server.handle(request)
+		message := map[string]any{
+			"type":        "response",
+			"request_seq": request.Seq,
+			"command":     request.Command,
+			"success":     err == nil,
+		}
+		if err != nil {
+			message["message"] = err.Error()
+		} else if result != nil {
+			message["body"] = result
+		}
+		server.write(message)
+		// The program is started or resumed once the client has the
+		// response, so that it cannot stop again before that.
+		switch request.Command {
+		case "initialize":
+			server.event("initialized", nil)
+		case "configurationDone", "launch":
+			server.start()
+		case "continue":
+			server.resume_with(debug_continue)
+		case "next":
+			server.resume_with(debug_next)
+		case "stepIn":
+			server.resume_with(debug_step)
+		case "stepOut":
+			server.resume_with(debug_finish)
+		case "disconnect", "terminate":
+			server.end()
+			return nil
+		}
+	}
+}
+
+func (server *dap_server) write(message map[string]any) {
+	server.write_lock.Lock()
+	defer server.write_lock.Unlock()
+	server.seq++
+	message["seq"] = server.seq
+	write_message(server.out, message)
+}
+
+func (server *dap_server) event(name string, body any) {
+	message := map[string]any{"type": "event", "event": name}
+	if body != nil {
+		message["body"] = body
+	}
+	server.write(message)
+}
+
+// dap_output sends what the program writes as output events.
+type dap_output struct {
+	server   *dap_server
+	category string
+}
+
+func (do dap_output) Write(bytes []byte) (int, error) {
+	do.server.event("output", map[string]any{"category": do.category, "output": string(bytes)})
+	return len(bytes), nil
+}
+
+// start runs the program once it has been launched and configured.
+func (server *dap_server) start() {
+	if !server.launched || !server.configured || server.running {
+		return
+	}
+	server.running = true
+	program := server.program
+	go func() {
+		defer close(server.done)
+		exit_code := 0
+		err := server.interp.RunFile(program)
+		if _, ok := err.(debug_quit); !ok && err != nil {
+			exit_code = 1
+			if _, ok := err.(RuntimeError); !ok {
+				server.event("output", map[string]any{"category": "stderr", "output": err.Error() + "\n"})
+			}
+		}
+		server.event("exited", map[string]any{"exitCode": exit_code})
+		server.event("terminated", nil)
+	}()
+}
+
+// end stops the program if it is running and waits for it to finish.
+func (server *dap_server) end() {
+	if !server.running {
+		return
+	}
+	server.db.halt()
+	server.resume_with(debug_stop)
+	<-server.done
+}
+
+// stopped is called on the goroutine of the program, and blocks it until
+// the client resumes it.
+func (server *dap_server) stopped(db *debugger, event debug_event) debug_action {
+	server.mutex.Lock()
+	server.stop, server.frames, server.handles = &event, db.stack(event), nil
+	server.mutex.Unlock()
+	body := map[string]any{"reason": event.reason, "threadId": dap_thread, "allThreadsStopped": true}
+	if event.breakpoint > 0 {
+		body["hitBreakpointIds"] = []int{event.breakpoint}
+	}
+	server.event("stopped", body)
+	return <-server.resume
+}
+
+// resume_with lets a stopped program go on, and reports whether it was
+// stopped.
+func (server *dap_server) resume_with(action debug_action) bool {
+	server.mutex.Lock()
+	stopped := server.stop != nil
+	server.stop, server.frames, server.handles = nil, nil, nil
+	server.mutex.Unlock()
+	if stopped {
+		server.resume <- action
+	}
+	return stopped
+}
+
+func (server *dap_server) handle(request dap_request) (any, error) {
+	switch request.Command {
+	case "initialize":
+		var args struct {
+			LinesStartAt1 *bool `json:"linesStartAt1"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		if args.LinesStartAt1 != nil {
+			server.one_based = *args.LinesStartAt1
+		}
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		if args.Program == "" {
+			return nil, fmt.Errorf("Missing program to launch")
+		}
+		if server.launched {
+			return nil, fmt.Errorf("A program was already launched")
+		}
+		// Fail the launch itself for a program that can't be run, rather
+		// than after configurationDone.
+		if info, err := os.Stat(args.Program); err != nil {
+			return nil, fmt.Errorf("Can't launch %s: %v", args.Program, errors.Unwrap(err))
+		} else if info.IsDir() {
+			return nil, fmt.Errorf("Can't launch %s: it is a directory", args.Program)
+		}
+		server.program, server.launched = args.Program, true
+		if args.StopOnEntry {
+			server.db.action, server.db.entry = debug_step, true
+		}
+		return nil, nil
+	case "configurationDone":
+		server.configured = true
+		return nil, nil
+	case "setBreakpoints":
+		var args struct {
+			Source      dap_source `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		lines := make([]int, len(args.Breakpoints))
+		for i, bp := range args.Breakpoints {
+			lines[i] = server.from_client(bp.Line)
+		}
+		breakpoints := []map[string]any{}
+		for _, bp := range server.db.set_breakpoints(args.Source.Path, lines) {
+			breakpoints = append(breakpoints, map[string]any{"id": bp.id, "verified": true, "line": server.to_client(bp.line)})
+		}
+		return map[string]any{"breakpoints": breakpoints}, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": dap_thread, "name": "main"}}}, nil
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next", "stepIn", "stepOut", "disconnect", "terminate":
+		return nil, nil
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	switch request.Command {
+	case "stackTrace":
+		frames := []map[string]any{}
+		for i, frame := range server.frames {
+			frames = append(frames, map[string]any{
+				"id":     i,
+				"name":   frame.name,
+				"source": dap_source{filepath.Base(frame.file), absolute(frame.file)},
+				"line":   server.to_client(frame.line),
+				"column": server.to_client(1),
+			})
+		}
+		return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		frame, err := server.frame(args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		scopes := []map[string]any{}
+		globals := frame_globals(frame.env)
+		if frame.env != globals {
+			scopes = append(scopes, map[string]any{"name": "Locals", "variablesReference": server.handle_for(dap_scope{frame.env, false}), "expensive": false})
+		}
+		if globals != nil {
+			scopes = append(scopes, map[string]any{"name": "Globals", "variablesReference": server.handle_for(dap_scope{globals, true}), "expensive": false})
+		}
+		return map[string]any{"scopes": scopes}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		if args.VariablesReference < 1 || args.VariablesReference > len(server.handles) {
+			return nil, fmt.Errorf("Unknown variables reference %d", args.VariablesReference)
+		}
+		return map[string]any{"variables": server.variables(server.handles[args.VariablesReference-1])}, nil
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+			FrameID    *int   `json:"frameId"`
+		}
+		json.Unmarshal(request.Arguments, &args)
+		if server.stop == nil {
+			return nil, fmt.Errorf("The program is not stopped")
+		}
+		env := server.stop.env
+		if args.FrameID != nil {
+			frame, err := server.frame(*args.FrameID)
+			if err != nil {
+				return nil, err
+			}
+			env = frame.env
+		}
+		value, err := server.evaluate(args.Expression, env)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": dap_value(value), "variablesReference": server.handle_for(value)}, nil
+	}
+	return nil, fmt.Errorf("Unsupported command '%s'", request.Command)
+}
+
+func (server *dap_server) frame(id int) (debug_frame, error) {
+	if id < 0 || id >= len(server.frames) {
+		return debug_frame{}, fmt.Errorf("Unknown frame %d", id)
+	}
+	return server.frames[id], nil
+}
+
+// evaluate evaluates expression in env, returning the first diagnostic
+// as the error when it does not parse.
+func (server *dap_server) evaluate(expression string, env *Environment) (Value, error) {
+	out := server.interp.reporter.out
+	server.interp.reporter.out = io.Discard
+	defer func() { server.interp.reporter.out = out }()
+	value, err := server.db.evaluate(expression, env)
+	if _, ok := err.(StaticError); ok && len(server.interp.diagnostics) > 0 {
+		return nil, fmt.Errorf("%s", server.interp.diagnostics[0].Message)
+	}
+	return value, err
+}
+
+func (server *dap_server) from_client(line int) int {
+	if server.one_based {
+		return line
+	}
+	return line + 1
+}
+
+func (server *dap_server) to_client(line int) int {
+	if server.one_based {
+		return line
+	}
+	return line - 1
+}
+
+// handle_for returns the variables reference of a scope or of a value
+// with members, or 0 for values without any.
+func (server *dap_server) handle_for(target any) int {
+	switch target.(type) {
+	case dap_scope, LoxInstance, *LoxList, *LoxMap, *Module:
+		server.handles = append(server.handles, target)
+		return len(server.handles)
+	}
+	return 0
+}
+
+// variables lists the members of target, which was given a handle.
+func (server *dap_server) variables(target any) []dap_variable {
+	variables := []dap_variable{}
+	add := func(name string, value Value) {
+		variables = append(variables, dap_variable{name, dap_value(value), server.handle_for(value)})
+	}
+	switch t := target.(type) {
+	case dap_scope:
+		var scopes []map[string]Value
+		if t.global {
+			scopes = append(scopes, t.env.values)
+		} else {
+			globals := frame_globals(t.env)
+			for env := t.env; env != nil && env != globals; env = env.enclosing {
+				scopes = append(scopes, env.values)
+			}
+		}
+		// An inner declaration hides an outer one of the same name.
+		values := make(map[string]Value)
+		for i := len(scopes) - 1; i >= 0; i-- {
+			for name, value := range scopes[i] {
+				values[name] = value
+			}
+		}
+		for _, name := range sorted_names(values) {
+			add(name, values[name])
+		}
+	case LoxInstance:
+		for _, name := range sorted_names(t.fields) {
+			add(name, t.fields[name])
+		}
+	case *LoxList:
+		for i, element := range t.elements {
+			add(strconv.Itoa(i), element)
+		}
+	case *LoxMap:
+		for _, entry := range t.entries {
+			add(dap_value(entry.key), entry.value)
+		}
+	case *Module:
+		for _, name := range sorted_names(t.globals.values) {
+			add(name, t.globals.values[name])
+		}
+	}
+	return variables
+}
+
+// frame_globals returns the globals of the module env belongs to, which
+// is the last environment before the builtins.
+func frame_globals(env *Environment) *Environment {
+	for env != nil && env.enclosing != nil && env.enclosing.enclosing != nil {
+		env = env.enclosing
+	}
+	return env
+}
+
+func absolute(file string) string {
+	if path, err := filepath.Abs(file); err == nil {
+		return path
+	}
+	return file
+}
+
+func sorted_names(values map[string]Value) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dap_value shows value as the client displays it, with strings quoted.
+func dap_value(value Value) string {
+	if text, ok := value.(string); ok {
+		return strconv.Quote(text)
+	}
+	return stringify(value)
+}
@@ -0,0 +1,461 @@
+package lox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// debug_action is how the program resumes after the debugger stops it.
+type debug_action int
+
+const (
+	// debug_continue runs until the next breakpoint.
+	debug_continue debug_action = iota
+	// debug_step stops on the next line, entering calls.
+	debug_step
+	// debug_next stops on the next line of the same or an outer call.
+	debug_next
+	// debug_finish stops once the current call has returned.
+	debug_finish
+	// debug_stop ends the program.
+	debug_stop
+)
+
+// debug_quit unwinds the program when the debugger ends it. It cannot be
+// caught, and is not reported as an error.
+type debug_quit struct{}
+
+func (dq debug_quit) Error() string {
+	return "Debugging stopped"
+}
+
+type breakpoint struct {
+	id   int
+	file string
+	line int
+}
+
+// debug_event describes where the program stopped. breakpoint is zero
+// unless the program stopped at one.
+type debug_event struct {
+	reason     string
+	breakpoint int
+	file       string
+	line       int
+	env        *Environment
+}
+
+// debug_frontend is the user interface of a debugger. stopped is called
+// whenever the program stops, and returns once the user resumes it.
+type debug_frontend interface {
+	stopped(db *debugger, event debug_event) debug_action
+}
+
+// debugger stops a tree-walking program at breakpoints and while
+// stepping. The interpreter calls reach before every statement and
+// expression, and the program stops when it reaches a new line.
+// Breakpoints may be changed while the program runs.
+type debugger struct {
+	interp      *Interpreter
+	frontend    debug_frontend
+	mutex       sync.Mutex
+	breakpoints []*breakpoint
+	last_id     int
+	action      debug_action
+	entry       bool
+	halted      atomic.Bool
+	// depth is the number of frames when the program was resumed, and
+	// lines and envs the line each active frame last reached and the
+	// environment it was running in.
+	depth int
+	lines []int
+	envs  []*Environment
+	paths map[string]string
+}
+
+// new_debugger returns a debugger that stops before the first line when
+// stop_on_entry is set, and otherwise at the first breakpoint.
+func new_debugger(interp *Interpreter, frontend debug_frontend, stop_on_entry bool) *debugger {
+	db := &debugger{interp: interp, frontend: frontend, entry: stop_on_entry, paths: make(map[string]string)}
+	if stop_on_entry {
+		db.action = debug_step
+	}
+	return db
+}
+
+// reach is called with the code about to run in env. It returns
+// debug_quit once the user has ended the program.
+func (db *debugger) reach(span Span, env *Environment) error {
+	if db.action == debug_stop || db.halted.Load() {
+		return debug_quit{}
+	}
+	line := span.start.line
+	depth := len(db.interp.frames)
+	if line <= 0 || depth == 0 || !db.move(depth, line, env) {
+		return nil
+	}
+	file := db.interp.frames[depth-1].file
+	event := debug_event{file: file, line: line, env: env}
+	if bp := db.breakpoint_at(file, line); bp != nil {
+		event.reason, event.breakpoint = "breakpoint", bp.id
+	} else {
+		switch {
+		case db.entry:
+			event.reason, db.entry = "entry", false
+		case db.action == debug_step:
+			event.reason = "step"
+		case db.action == debug_next && depth <= db.depth:
+			event.reason = "step"
+		case db.action == debug_finish && depth < db.depth:
+			event.reason = "step"
+		default:
+			return nil
+		}
+	}
+	db.action = db.frontend.stopped(db, event)
+	db.depth = len(db.interp.frames)
+	if db.action == debug_stop {
+		return debug_quit{}
+	}
+	return nil
+}
+
+// halt ends the program the next time it reaches any code. It may be
+// called while the program runs.
+func (db *debugger) halt() {
+	db.halted.Store(true)
+}
+
+// move records that the frame at depth reached line in env, and reports
+// whether that frame was on another line before.
+func (db *debugger) move(depth int, line int, env *Environment) bool {
+	if depth > len(db.lines) {
+		db.lines = append(db.lines, make([]int, depth-len(db.lines))...)
+		db.envs = append(db.envs, make([]*Environment, depth-len(db.envs))...)
+	}
+	db.lines, db.envs = db.lines[:depth], db.envs[:depth]
+	db.envs[depth-1] = env
+	if db.lines[depth-1] == line {
+		return false
+	}
+	db.lines[depth-1] = line
+	return true
+}
+
+// path returns the absolute form of file, which is how breakpoints name
+// their files. It is called with the mutex held.
+func (db *debugger) path(file string) string {
+	if path, ok := db.paths[file]; ok {
+		return path
+	}
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+	db.paths[file] = path
+	return path
+}
+
+func (db *debugger) add_breakpoint(file string, line int) *breakpoint {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.last_id++
+	bp := &breakpoint{db.last_id, db.path(file), line}
+	db.breakpoints = append(db.breakpoints, bp)
+	return bp
+}
+
+// set_breakpoints replaces the breakpoints in file with ones at lines.
+func (db *debugger) set_breakpoints(file string, lines []int) []*breakpoint {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	path := db.path(file)
+	kept := db.breakpoints[:0]
+	for _, bp := range db.breakpoints {
+		if bp.file != path {
+			kept = append(kept, bp)
+		}
+	}
+	db.breakpoints = kept
+	added := make([]*breakpoint, len(lines))
+	for i, line := range lines {
+		db.last_id++
+		added[i] = &breakpoint{db.last_id, path, line}
+		db.breakpoints = append(db.breakpoints, added[i])
+	}
+	return added
+}
+
+// list_breakpoints returns the breakpoints, in the order they were set.
+func (db *debugger) list_breakpoints() []*breakpoint {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return append([]*breakpoint{}, db.breakpoints...)
+}
+
+// remove_breakpoint deletes the breakpoint with id, or every breakpoint
+// when id is zero.
+func (db *debugger) remove_breakpoint(id int) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if id == 0 {
+		db.breakpoints = nil
+		return true
+	}
+	for i, bp := range db.breakpoints {
+		if bp.id == id {
+			db.breakpoints = append(db.breakpoints[:i], db.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (db *debugger) breakpoint_at(file string, line int) *breakpoint {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if len(db.breakpoints) == 0 {
+		return nil
+	}
+	path := db.path(file)
+	for _, bp := range db.breakpoints {
+		if bp.line == line && bp.file == path {
+			return bp
+		}
+	}
+	return nil
+}
+
+// debug_frame is an active call while the program is stopped, and the
+// environment it is running in.
+type debug_frame struct {
+	trace_frame
+	env *Environment
+}
+
+// stack returns the active calls, innermost first, with the innermost at
+// the line the program stopped on.
+func (db *debugger) stack(event debug_event) []debug_frame {
+	frames := db.interp.frames
+	stack := make([]debug_frame, len(frames))
+	for i, frame := range frames {
+		stack[len(frames)-1-i] = debug_frame{frame, db.envs[i]}
+	}
+	if len(stack) > 0 {
+		stack[0].line, stack[0].env = event.line, event.env
+	}
+	return stack
+}
+
+// evaluate parses source as an expression and evaluates it in env. Names
+// are looked up through env the way code written at the stopping point
+// would find them.
+func (db *debugger) evaluate(source string, env *Environment) (Value, error) {
+	interp := db.interp
+	interp.begin(source, "")
+	defer interp.flush()
+	lexer := NewLexer(source, interp.reporter)
+	parser := Parser{tokens: lexer.scan_tokens(), reporter: interp.reporter}
+	expr, err := parser.expression()
+	if err == nil && !parser.finished() {
+		err = parser.error(parser.peek(), code_syntax, "Expect end of expression")
+	}
+	if err != nil || interp.had_error {
+		return nil, StaticError{"parsing"}
+	}
+	scopes := Stack{}
+	class := NOCLASS
+	for scope := env; scope != nil && scope != interp.globals; scope = scope.enclosing {
+		names := make(map[string]bool)
+		for name := range scope.values {
+			names[name] = true
+		}
+		if names["super"] {
+			class = SUBCLASS
+		} else if names["this"] && class == NOCLASS {
+			class = NORMALCLASS
+		}
+		scopes = append(Stack{names}, scopes...)
+	}
+	rs := Resolver{interp: interp, init_scopes: &scopes, curr_function: FUNCTION, curr_class: class}
+	rs.resolve_expr(expr, &scopes)
+	if interp.had_error {
+		return nil, StaticError{"resolving"}
+	}
+	// The expression runs without stopping, even when it calls functions
+	// with breakpoints.
+	interp.debugger = nil
+	defer func() { interp.debugger = db }()
+	value, err := interp.evaluate(expr, env)
+	interp.trace = nil
+	if err != nil {
+		return nil, uncaught(err)
+	}
+	return value, nil
+}
+
+// Debug runs the script at path under a command-line debugger, which
+// reads commands from in and writes to out. The program stops before its
+// first line. Debugging always uses the TreeWalk backend.
+func (interp *Interpreter) Debug(path string, in io.Reader, out io.Writer) error {
+	console := &debug_console{script: path, in: bufio.NewScanner(in), out: out, sources: make(map[string][]string)}
+	interp.backend = TreeWalk
+	interp.debugger = new_debugger(interp, console, true)
+	defer func() { interp.debugger = nil }()
+	fmt.Fprintf(out, "Debugging %s. Type help for a list of commands.\n", path)
+	err := interp.RunFile(path)
+	if _, ok := err.(debug_quit); ok {
+		return nil
+	}
+	if err == nil {
+		fmt.Fprintln(out, "Program finished")
+	}
+	return err
+}
+
+// debug_console is the command-line frontend of glox debug.
+type debug_console struct {
+	script  string
+	in      *bufio.Scanner
+	out     io.Writer
+	last    string
+	sources map[string][]string
+}
+
+const debug_help = `Commands:
+  break [file:]line  (b)   set a breakpoint, or list them without a line
+  delete [number]    (d)   delete a breakpoint, or all of them
+  continue           (c)   run until the next breakpoint
+  step               (s)   run to the next line, entering calls
+  next               (n)   run to the next line, stepping over calls
+  finish             (f)   run until the current function returns
+  print expression   (p)   evaluate an expression where the program stopped
+  backtrace          (bt)  show the call stack
+  list               (l)   show the source around the current line
+  quit               (q)   end the program
+An empty line repeats the last command.`
+
+func (dc *debug_console) stopped(db *debugger, event debug_event) debug_action {
+	if event.breakpoint > 0 {
+		fmt.Fprintf(dc.out, "Breakpoint %d, ", event.breakpoint)
+	}
+	fmt.Fprintf(dc.out, "%s:%d\n", display_file(event.file), event.line)
+	dc.show(event.file, event.line, event.line)
+	for {
+		fmt.Fprint(dc.out, "(glox) ")
+		if !dc.in.Scan() {
+			fmt.Fprintln(dc.out)
+			return debug_stop
+		}
+		line := strings.TrimSpace(dc.in.Text())
+		if line == "" {
+			line = dc.last
+		}
+		dc.last = line
+		command, argument, _ := strings.Cut(line, " ")
+		argument = strings.TrimSpace(argument)
+		switch command {
+		case "":
+		case "c", "continue":
+			return debug_continue
+		case "s", "step":
+			return debug_step
+		case "n", "next":
+			return debug_next
+		case "f", "finish":
+			return debug_finish
+		case "q", "quit":
+			return debug_stop
+		case "b", "break":
+			dc.set_breakpoint(db, argument)
+		case "d", "delete":
+			dc.delete_breakpoint(db, argument)
+		case "p", "print":
+			dc.print(db, event, argument)
+		case "bt", "backtrace":
+			for i, frame := range db.stack(event) {
+				fmt.Fprintf(dc.out, "#%d %s (%s:%d)\n", i, frame.name, display_file(frame.file), frame.line)
+			}
+		case "l", "list":
+			dc.show(event.file, event.line-5, event.line+5)
+		case "h", "help":
+			fmt.Fprintln(dc.out, debug_help)
+		default:
+			fmt.Fprintf(dc.out, "Unknown command '%s'. Type help for a list of commands.\n", command)
+		}
+	}
+}
+
+func (dc *debug_console) set_breakpoint(db *debugger, argument string) {
+	if argument == "" {
+		breakpoints := db.list_breakpoints()
+		if len(breakpoints) == 0 {
+			fmt.Fprintln(dc.out, "No breakpoints")
+		}
+		for _, bp := range breakpoints {
+			fmt.Fprintf(dc.out, "%d: %s:%d\n", bp.id, display_file(bp.file), bp.line)
+		}
+		return
+	}
+	file, number := dc.script, argument
+	if colon := strings.LastIndexByte(argument, ':'); colon >= 0 {
+		file, number = argument[:colon], argument[colon+1:]
+	}
+	line, err := strconv.Atoi(number)
+	if err != nil || line < 1 {
+		fmt.Fprintf(dc.out, "Invalid line '%s'\n", number)
+		return
+	}
+	bp := db.add_breakpoint(file, line)
+	fmt.Fprintf(dc.out, "Breakpoint %d at %s:%d\n", bp.id, display_file(bp.file), bp.line)
+}
+
+func (dc *debug_console) delete_breakpoint(db *debugger, argument string) {
+	if argument == "" {
+		db.remove_breakpoint(0)
+		fmt.Fprintln(dc.out, "Deleted all breakpoints")
+		return
+	}
+	id, err := strconv.Atoi(argument)
+	if err != nil || id == 0 || !db.remove_breakpoint(id) {
+		fmt.Fprintf(dc.out, "No breakpoint '%s'\n", argument)
+	}
+}
+
+func (dc *debug_console) print(db *debugger, event debug_event, argument string) {
+	if argument == "" {
+		fmt.Fprintln(dc.out, "Expected an expression to print")
+		return
+	}
+	value, err := db.evaluate(argument, event.env)
+	if _, ok := err.(StaticError); ok {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(dc.out, err)
+		return
+	}
+	fmt.Fprintln(dc.out, stringify(value))
+}
+
+// show prints the lines from first to last of file that exist, with
+// their numbers.
+func (dc *debug_console) show(file string, first int, last int) {
+	lines, ok := dc.sources[file]
+	if !ok {
+		if bytes, err := os.ReadFile(file); err == nil {
+			lines = strings.Split(string(bytes), "\n")
+		}
+		dc.sources[file] = lines
+	}
+	for line := max(first, 1); line <= last && line <= len(lines); line++ {
+		fmt.Fprintf(dc.out, "%4d | %s\n", line, lines[line-1])
+	}
+}
@@ -0,0 +1,256 @@
+package lox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity is how serious a Diagnostic is. Only errors stop a script from
+// running.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (sv Severity) String() string {
+	if sv == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Error codes of the diagnostics reported before a script runs, grouped
+// by the phase that finds them, followed by the warnings of glox lint.
+const (
+	code_unexpected_character = "E0001"
+	code_unterminated_string  = "E0002"
+
+	code_syntax             = "E0100"
+	code_invalid_assignment = "E0101"
+	code_too_many_arguments = "E0102"
+
+	code_inherit_self       = "E0200"
+	code_jump_outside_loop  = "E0201"
+	code_top_level_return   = "E0202"
+	code_initializer_return = "E0203"
+	code_invalid_super      = "E0204"
+	code_this_outside_class = "E0205"
+	code_own_initializer    = "E0206"
+	code_duplicate_variable = "E0207"
+	code_compiler_limit     = "E0300"
+
+	code_misplaced_comment = "E0400"
+
+	code_unused_variable    = "W0001"
+	code_unreachable_code   = "W0002"
+	code_shadowing          = "W0003"
+	code_undeclared_global  = "W0004"
+	code_init_return        = "W0005"
+	code_constant_condition = "W0006"
+)
+
+// Diagnostic is a problem found in a script by the lexer, parser, resolver
+// or compiler.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	File     string
+	Span     Span
+}
+
+// DiagnosticFormat selects how diagnostics are written.
+type DiagnosticFormat int
+
+const (
+	// TextDiagnostics shows each diagnostic with the source line it
+	// points at, underlined with carets.
+	TextDiagnostics DiagnosticFormat = iota
+	// JSONDiagnostics writes each diagnostic as a JSON object on its own
+	// line.
+	JSONDiagnostics
+)
+
+// WithDiagnosticFormat selects how diagnostics are written to stderr.
+func WithDiagnosticFormat(format DiagnosticFormat) Option {
+	return func(interp *Interpreter) {
+		interp.reporter.format = format
+	}
+}
+
+// Diagnostics returns the diagnostics reported for the most recently
+// analyzed source.
+func (interp *Interpreter) Diagnostics() []Diagnostic {
+	return interp.diagnostics
+}
+
+// Line returns the line of the position, starting at 1.
+func (ps Position) Line() int {
+	return ps.line
+}
+
+// Column returns the column of the position in runes, starting at 1.
+func (ps Position) Column() int {
+	return ps.column
+}
+
+// Offset returns the byte offset of the position in the source.
+func (ps Position) Offset() int {
+	return ps.offset
+}
+
+// Start returns the first position of the span.
+func (sp Span) Start() Position {
+	return sp.start
+}
+
+// End returns the position just past the span.
+func (sp Span) End() Position {
+	return sp.end
+}
+
+// reporter collects the diagnostics of the source being analyzed and
+// writes them out, as well as runtime errors.
+type reporter struct {
+	out         io.Writer
+	format      DiagnosticFormat
+	had_error   bool
+	source      string
+	file        string
+	diagnostics []Diagnostic
+	flushed     int
+}
+
+// begin starts collecting diagnostics for source.
+func (rp *reporter) begin(source string, file string) {
+	rp.had_error = false
+	rp.source, rp.file = source, file
+	rp.diagnostics, rp.flushed = nil, 0
+}
+
+func (rp *reporter) error_at(span Span, code string, message string) {
+	rp.add(Diagnostic{SeverityError, code, message, rp.file, span})
+}
+
+func (rp *reporter) token_error(token Token, code string, message string) {
+	rp.error_at(token.span, code, message)
+}
+
+// line_error reports an error for code that only knows its line.
+func (rp *reporter) line_error(line int, code string, message string) {
+	rp.error_at(Span{start: Position{line: line}}, code, message)
+}
+
+func (rp *reporter) add(diagnostic Diagnostic) {
+	rp.diagnostics = append(rp.diagnostics, diagnostic)
+	if diagnostic.Severity == SeverityError {
+		rp.had_error = true
+	}
+}
+
+// flush writes the diagnostics reported since the last flush.
+func (rp *reporter) flush() {
+	for _, diagnostic := range rp.diagnostics[rp.flushed:] {
+		if rp.format == JSONDiagnostics {
+			write_json(rp.out, diagnostic)
+		} else {
+			write_text(rp.out, diagnostic, rp.source)
+		}
+	}
+	rp.flushed = len(rp.diagnostics)
+}
+
+// write_text renders a diagnostic in the style of rustc:
+//
+//	error[E0100]: Expect ';' after value
+//	 --> script.lox:1:8
+//	  |
+//	1 | print 1
+//	  |        ^
+func write_text(w io.Writer, diagnostic Diagnostic, source string) {
+	start, end := diagnostic.Span.start, diagnostic.Span.end
+	file := diagnostic.File
+	if file == "" {
+		file = "<input>"
+	}
+	fmt.Fprintf(w, "%s[%s]: %s\n", diagnostic.Severity, diagnostic.Code, diagnostic.Message)
+	if start.column == 0 {
+		fmt.Fprintf(w, " --> %s:%d\n", file, start.line)
+		return
+	}
+	fmt.Fprintf(w, " --> %s:%d:%d\n", file, start.line, start.column)
+	text := source_line(source, start)
+	gutter := strings.Repeat(" ", len(fmt.Sprint(start.line)))
+	width := 1
+	if end.line == start.line && end.column > start.column {
+		width = end.column - start.column
+	} else if end.line > start.line {
+		width = max(1, utf8.RuneCountInString(text)-start.column+1)
+	}
+	fmt.Fprintf(w, "%s |\n", gutter)
+	fmt.Fprintf(w, "%d | %s\n", start.line, text)
+	fmt.Fprintf(w, "%s | %s%s\n", gutter, caret_padding(text, start.column), strings.Repeat("^", width))
+}
+
+// source_line returns the text of the line that pos is on.
+func source_line(source string, pos Position) string {
+	begin := strings.LastIndexByte(source[:pos.offset], '\n') + 1
+	end := strings.IndexByte(source[pos.offset:], '\n')
+	if end < 0 {
+		return source[begin:]
+	}
+	return strings.TrimRight(source[begin:pos.offset+end], "\r")
+}
+
+// caret_padding returns the whitespace that lines a caret up under column,
+// keeping the tabs of the source line so that it lines up on any terminal.
+func caret_padding(text string, column int) string {
+	var padding strings.Builder
+	for i, rn := range []rune(text) {
+		if i >= column-1 {
+			break
+		}
+		if rn == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+	for i := utf8.RuneCountInString(text); i < column-1; i++ {
+		padding.WriteRune(' ')
+	}
+	return padding.String()
+}
+
+type json_position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+type json_diagnostic struct {
+	Severity string        `json:"severity"`
+	Code     string        `json:"code"`
+	Message  string        `json:"message"`
+	File     string        `json:"file"`
+	Start    json_position `json:"start"`
+	End      json_position `json:"end"`
+}
+
+func write_json(w io.Writer, diagnostic Diagnostic) {
+	start, end := diagnostic.Span.start, diagnostic.Span.end
+	encoded, _ := json.Marshal(json_diagnostic{
+		diagnostic.Severity.String(),
+		diagnostic.Code,
+		diagnostic.Message,
+		diagnostic.File,
+		json_position{start.line, start.column, start.offset},
+		json_position{end.line, end.column, end.offset},
+	})
+	fmt.Fprintf(w, "%s\n", encoded)
+}
@@ -0,0 +1,139 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+)
+
+// Disassemble compiles source without running it and writes a listing of
+// the bytecode of the script and of every function and method it declares.
+func (interp *Interpreter) Disassemble(source string) error {
+	stmts, err := interp.analyze(source, "")
+	if err != nil {
+		return err
+	}
+	function := interp.compile(stmts, "")
+	interp.flush()
+	if interp.had_error {
+		return StaticError{"compiling"}
+	}
+	disassemble_function(interp.stdout, function)
+	return nil
+}
+
+// disassemble_function lists the chunk of function, followed by the
+// listings of the functions nested in its constant pool.
+func disassemble_function(w io.Writer, function *Function) {
+	disassemble_chunk(w, &function.chunk, function.String())
+	for _, constant := range function.chunk.constants {
+		if nested, ok := constant.(*Function); ok {
+			fmt.Fprintln(w)
+			disassemble_function(w, nested)
+		}
+	}
+}
+
+func disassemble_chunk(w io.Writer, chunk *Chunk, name string) {
+	fmt.Fprintf(w, "== %s ==\n", name)
+	for offset := 0; offset < len(chunk.code); {
+		offset = disassemble_instruction(w, chunk, offset)
+	}
+}
+
+func disassemble_instruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if offset > 0 && chunk.lines[offset] == chunk.lines[offset-1] {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", chunk.lines[offset])
+	}
+	op := OpCode(chunk.code[offset])
+	switch op {
+	case OP_CONSTANT:
+		return constant_instruction(w, op, chunk, offset)
+	case OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL:
+		return variable_instruction(w, op, chunk, offset, chunk.read_short(offset+1), 3)
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE:
+		return variable_instruction(w, op, chunk, offset, int(chunk.code[offset+1]), 2)
+	case OP_GET_PROPERTY, OP_SET_PROPERTY, OP_GET_SUPER, OP_METHOD:
+		return constant_instruction(w, op, chunk, offset)
+	case OP_CALL:
+		fmt.Fprintf(w, "%-16s %4d\n", op, chunk.code[offset+1])
+		return offset + 2
+	case OP_LIST, OP_MAP:
+		fmt.Fprintf(w, "%-16s %4d\n", op, chunk.read_short(offset+1))
+		return offset + 3
+	case OP_JUMP, OP_JUMP_IF_FALSE:
+		return jump_instruction(w, op, 1, chunk, offset)
+	case OP_LOOP:
+		return jump_instruction(w, op, -1, chunk, offset)
+	case OP_IMPORT:
+		index := chunk.read_short(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d '%s'\n", op, index, chunk.constants[index])
+		return offset + 5
+	case OP_TRY:
+		jump := chunk.read_short(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d -> %d", op, offset, offset+3+jump)
+		if chunk.code[offset+3] == 1 {
+			fmt.Fprint(w, " finally")
+		}
+		fmt.Fprintln(w)
+		return offset + 4
+	case OP_CLASS:
+		index := chunk.read_short(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d '%s'", op, index, stringify(chunk.constants[index]))
+		if chunk.code[offset+3] == 1 {
+			fmt.Fprint(w, " inherits")
+		}
+		fmt.Fprintln(w)
+		return offset + 4
+	case OP_CLOSURE:
+		index := chunk.read_short(offset + 1)
+		function := chunk.constants[index].(*Function)
+		fmt.Fprintf(w, "%-16s %4d %s\n", op, index, function)
+		offset += 3
+		for i := 0; i < function.upvalue_count; i++ {
+			kind := "upvalue"
+			if chunk.code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.code[offset+1])
+			offset += 2
+		}
+		return offset
+	}
+	fmt.Fprintf(w, "%s\n", op)
+	return offset + 1
+}
+
+func constant_instruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	index := chunk.read_short(offset + 1)
+	constant := chunk.constants[index]
+	if s, ok := constant.(string); ok && op == OP_CONSTANT {
+		constant = fmt.Sprintf("%q", s)
+	}
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", op, index, stringify(constant))
+	return offset + 3
+}
+
+// variable_instruction prints a variable access together with the name
+// and the scope depth the resolver assigned to it.
+func variable_instruction(w io.Writer, op OpCode, chunk *Chunk, offset int, operand int, length int) int {
+	access := chunk.accesses[offset]
+	fmt.Fprintf(w, "%-16s %4d '%s'", op, operand, access.name)
+	switch access.depth {
+	case no_depth:
+	case -1:
+		fmt.Fprint(w, " (global)")
+	default:
+		fmt.Fprintf(w, " (depth %d)", access.depth)
+	}
+	fmt.Fprintln(w)
+	return offset + length
+}
+
+func jump_instruction(w io.Writer, op OpCode, sign int, chunk *Chunk, offset int) int {
+	jump := chunk.read_short(offset + 1)
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3+sign*jump)
+	return offset + 3
+}
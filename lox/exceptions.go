@@ -0,0 +1,60 @@
+package lox
+
+// LoxError is the value a catch clause receives for an error raised by
+// the interpreter itself, such as adding a number to a string.
+type LoxError struct {
+	message string
+	line    int
+}
+
+func (le *LoxError) get(name Token) (Value, error) {
+	switch name.lexeme {
+	case "message":
+		return le.message, nil
+	case "line":
+		return float64(le.line), nil
+	}
+	return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+}
+
+func (le *LoxError) String() string {
+	return "<error: " + le.message + ">"
+}
+
+// ThrowVal unwinds the stack for a throw statement until a catch clause
+// receives its value.
+type ThrowVal struct {
+	value Value
+	token Token
+}
+
+func (tv ThrowVal) Error() string {
+	return stringify(tv.value)
+}
+
+// caught_value converts err into the value bound by a catch clause. Errors
+// that only unwind the stack, such as returns, are not caught.
+func caught_value(err error) (Value, bool) {
+	switch t := err.(type) {
+	case RuntimeError:
+		return &LoxError{t.message, t.token.line}, true
+	case ThrowVal:
+		return t.value, true
+	}
+	return nil, false
+}
+
+// uncaught converts an error that escaped the script into the RuntimeError
+// reported for it. A rethrown error reports as it did when first raised.
+func uncaught(err error) RuntimeError {
+	if tv, ok := err.(ThrowVal); ok {
+		if le, ok := tv.value.(*LoxError); ok {
+			return RuntimeError{le.message, Token{line: le.line}}
+		}
+		return RuntimeError{stringify(tv.value), tv.token}
+	}
+	if le, ok := err.(LimitError); ok {
+		return RuntimeError{le.Error(), Token{line: le.line}}
+	}
+	return err.(RuntimeError)
+}
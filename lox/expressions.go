@@ -0,0 +1,218 @@
+package lox
+
+type Expr interface {
+	accept()
+	span() Span
+}
+
+type Assign struct {
+	name  Token
+	value Expr
+}
+
+func (as *Assign) accept() {
+}
+
+func (as *Assign) span() Span {
+	return as.name.span.to(as.value.span())
+}
+
+type Binary struct {
+	left     Expr
+	operator Token
+	right    Expr
+}
+
+func (bn *Binary) accept() {
+}
+
+func (bn *Binary) span() Span {
+	return bn.left.span().to(bn.right.span())
+}
+
+type Call struct {
+	callee    Expr
+	paren     Token
+	arguments []Expr
+}
+
+func (ca *Call) accept() {
+}
+
+func (ca *Call) span() Span {
+	return ca.callee.span().to(ca.paren.span)
+}
+
+type Get struct {
+	object Expr
+	name   Token
+}
+
+func (gt *Get) accept() {
+}
+
+func (gt *Get) span() Span {
+	return gt.object.span().to(gt.name.span)
+}
+
+type Grouping struct {
+	expression Expr
+	loc        Span
+}
+
+func (gp *Grouping) accept() {
+}
+
+func (gp *Grouping) span() Span {
+	return gp.loc
+}
+
+type Index struct {
+	object  Expr
+	bracket Token
+	index   Expr
+}
+
+func (ix *Index) accept() {
+}
+
+func (ix *Index) span() Span {
+	return ix.object.span().to(ix.bracket.span)
+}
+
+// Lambda is an anonymous function expression.
+type Lambda struct {
+	function Func
+}
+
+func (lb *Lambda) accept() {
+}
+
+func (lb *Lambda) span() Span {
+	return lb.function.loc
+}
+
+type List struct {
+	bracket  Token
+	elements []Expr
+	loc      Span
+}
+
+func (ls *List) accept() {
+}
+
+func (ls *List) span() Span {
+	return ls.loc
+}
+
+type Map struct {
+	brace  Token
+	keys   []Expr
+	values []Expr
+	loc    Span
+}
+
+func (mp *Map) accept() {
+}
+
+func (mp *Map) span() Span {
+	return mp.loc
+}
+
+type Literal struct {
+	value Value
+	loc   Span
+}
+
+func (lt *Literal) accept() {
+}
+
+func (lt *Literal) span() Span {
+	return lt.loc
+}
+
+type Logical struct {
+	left     Expr
+	operator Token
+	right    Expr
+}
+
+func (lg *Logical) accept() {
+}
+
+func (lg *Logical) span() Span {
+	return lg.left.span().to(lg.right.span())
+}
+
+type Set struct {
+	object Expr
+	name   Token
+	value  Expr
+}
+
+func (st *Set) accept() {
+}
+
+func (st *Set) span() Span {
+	return st.object.span().to(st.value.span())
+}
+
+type SetIndex struct {
+	object  Expr
+	bracket Token
+	index   Expr
+	value   Expr
+}
+
+func (si *SetIndex) accept() {
+}
+
+func (si *SetIndex) span() Span {
+	return si.object.span().to(si.value.span())
+}
+
+type Super struct {
+	keyword Token
+	method  Token
+}
+
+func (sp *Super) accept() {
+}
+
+func (sp *Super) span() Span {
+	return sp.keyword.span.to(sp.method.span)
+}
+
+type This struct {
+	keyword Token
+}
+
+func (th *This) accept() {
+}
+
+func (th *This) span() Span {
+	return th.keyword.span
+}
+
+type Unary struct {
+	operator Token
+	right    Expr
+}
+
+func (un *Unary) accept() {
+}
+
+func (un *Unary) span() Span {
+	return un.operator.span.to(un.right.span())
+}
+
+type Variable struct {
+	name Token
+}
+
+func (vr *Variable) accept() {
+}
+
+func (vr *Variable) span() Span {
+	return vr.name.span
+}
@@ -0,0 +1,410 @@
+package lox
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Lines longer than format_width are wrapped by putting the arguments of
+// a call, or the elements of a list or map, on lines of their own.
+const (
+	format_width  = 80
+	format_indent = "  "
+)
+
+// Format parses source and prints it back in the canonical style. Comments
+// are kept, and at most one blank line is kept between statements. Source
+// that does not parse, or with comments inside an expression or a
+// statement header, where they could not be kept, is reported and not
+// formatted.
+func (interp *Interpreter) Format(source string, file string) (string, error) {
+	interp.begin(source, file)
+	defer interp.flush()
+	lexer := NewLexer(source, interp.reporter)
+	tokens := lexer.scan_tokens()
+	parser := Parser{tokens: tokens, reporter: interp.reporter, file: file}
+	stmts, err := parser.parse()
+	if err != nil {
+		return "", err
+	}
+	if interp.had_error {
+		return "", StaticError{"parsing"}
+	}
+	fm := formatter{source: source, comments: lexer.comments, reporter: interp.reporter}
+	formatted := fm.statements(stmts, 0, len(source), fm.statement)
+	if interp.had_error {
+		return "", StaticError{"formatting"}
+	}
+	return formatted, nil
+}
+
+// formatter prints statements and expressions as strings. Comments are
+// taken in source order as the statements around them are printed.
+type formatter struct {
+	source   string
+	comments []Comment
+	next     int
+	reporter *reporter
+}
+
+func pad(indent int) string {
+	return strings.Repeat(format_indent, indent)
+}
+
+// text returns the source covered by span.
+func (fm *formatter) text(span Span) string {
+	return fm.source[span.start.offset:span.end.offset]
+}
+
+// is_for reports whether the statement at span was written as a for loop,
+// which the parser turns into a while loop inside a block.
+func (fm *formatter) is_for(span Span) bool {
+	return strings.HasPrefix(fm.source[span.start.offset:], "for")
+}
+
+// statements prints one statement per line at indent, with the comments
+// that come before end. Blank lines between statements are kept, but
+// never more than one.
+func (fm *formatter) statements(stmts []Stmt, indent int, end int, print func(Stmt, int) string) string {
+	var out strings.Builder
+	last_line := -1
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		span := stmt.span()
+		fm.comments_before(&out, span.start.offset, indent, &last_line)
+		if last_line >= 0 && span.start.line > last_line+1 {
+			out.WriteString("\n")
+		}
+		out.WriteString(pad(indent) + print(stmt, indent))
+		last_line = span.end.line
+		fm.misplaced(span.end.offset)
+		if fm.next < len(fm.comments) && fm.comments[fm.next].span.start.line == span.end.line &&
+			fm.comments[fm.next].span.start.offset < end {
+			out.WriteString(" " + fm.comments[fm.next].text)
+			fm.next++
+		}
+		out.WriteString("\n")
+	}
+	fm.comments_before(&out, end, indent, &last_line)
+	return out.String()
+}
+
+// comments_before prints the comments that start before offset on lines
+// of their own.
+func (fm *formatter) comments_before(out *strings.Builder, offset int, indent int, last_line *int) {
+	for fm.next < len(fm.comments) && fm.comments[fm.next].span.start.offset < offset {
+		comment := fm.comments[fm.next]
+		if *last_line >= 0 && comment.span.start.line > *last_line+1 {
+			out.WriteString("\n")
+		}
+		out.WriteString(pad(indent) + comment.text + "\n")
+		*last_line = comment.span.start.line
+		fm.next++
+	}
+}
+
+// misplaced reports the comments that start before offset. Comments inside
+// an expression or a statement header cannot stay where they were, and
+// moving them would attach them to other code.
+func (fm *formatter) misplaced(offset int) {
+	for fm.next < len(fm.comments) && fm.comments[fm.next].span.start.offset < offset {
+		message := "Can't format a comment inside a statement; move it to a line of its own."
+		fm.reporter.error_at(fm.comments[fm.next].span, code_misplaced_comment, message)
+		fm.next++
+	}
+}
+
+// opening returns the offset of the first bracket at or after offset.
+func (fm *formatter) opening(offset int, bracket byte) int {
+	return offset + strings.IndexByte(fm.source[offset:], bracket)
+}
+
+// block prints a braced block of stmts that ends at end.
+func (fm *formatter) block(stmts []Stmt, indent int, end int) string {
+	body := fm.statements(stmts, indent+1, end, fm.statement)
+	if body == "" {
+		return "{}"
+	}
+	return "{\n" + body + pad(indent) + "}"
+}
+
+// body prints the body of an if, while, for or try after its header.
+func (fm *formatter) body(stmt Stmt, indent int) string {
+	fm.misplaced(stmt.span().start.offset)
+	return " " + fm.statement(stmt, indent)
+}
+
+func (fm *formatter) statement(stmt Stmt, indent int) string {
+	col := len(pad(indent))
+	switch t := stmt.(type) {
+	case Block:
+		if fm.is_for(t.loc) {
+			return fm.for_loop(t.statements[0], t.statements[1].(While), indent)
+		}
+		return fm.block(t.statements, indent, t.loc.end.offset)
+	case Class:
+		header := "class " + t.name.lexeme
+		if t.superclass != nil {
+			header += " < " + t.superclass.name.lexeme
+		}
+		var methods []Stmt
+		for _, method := range t.methods {
+			methods = append(methods, method)
+		}
+		body := fm.statements(methods, indent+1, t.loc.end.offset, fm.method)
+		if body == "" {
+			return header + " {}"
+		}
+		return header + " {\n" + body + pad(indent) + "}"
+	case Expression:
+		return fm.expr(t.expr, indent, col) + ";"
+	case Func:
+		return "fun " + fm.method(t, indent)
+	case If:
+		out := "if (" + fm.expr(t.condition, indent, col+4) + ")" + fm.body(t.then_branch, indent)
+		if t.else_branch != nil {
+			out += " else" + fm.body(t.else_branch, indent)
+		}
+		return out
+	case Print:
+		return "print " + fm.expr(t.expr, indent, col+6) + ";"
+	case Break:
+		return "break;"
+	case Continue:
+		return "continue;"
+	case Return:
+		if t.value == nil {
+			return "return;"
+		}
+		return "return " + fm.expr(t.value, indent, col+7) + ";"
+	case Throw:
+		return "throw " + fm.expr(t.value, indent, col+6) + ";"
+	case Try:
+		out := "try" + fm.body(t.body, indent)
+		if t.catch != nil {
+			fm.misplaced(t.catch.loc.start.offset)
+			out += " catch (" + t.catch.name.lexeme + ") " + fm.block(t.catch.body, indent, t.catch.loc.end.offset)
+		}
+		if t.finally != nil {
+			fm.misplaced(t.finally.loc.start.offset)
+			out += " finally " + fm.statement(*t.finally, indent)
+		}
+		return out
+	case Import:
+		return "import \"" + t.path + "\" as " + t.name.lexeme + ";"
+	case Var:
+		if t.initializer == nil {
+			return "var " + t.name.lexeme + ";"
+		}
+		prefix := "var " + t.name.lexeme + " = "
+		return prefix + fm.expr(t.initializer, indent, col+len(prefix)) + ";"
+	case While:
+		if fm.is_for(t.loc) {
+			return fm.for_loop(nil, t, indent)
+		}
+		return "while (" + fm.expr(t.condition, indent, col+7) + ")" + fm.body(t.body, indent)
+	}
+	return fm.text(stmt.span())
+}
+
+// for_loop prints a while loop the parser desugared from a for loop,
+// together with its initializer.
+func (fm *formatter) for_loop(initializer Stmt, loop While, indent int) string {
+	col := len(pad(indent))
+	header := "for ("
+	if initializer != nil {
+		header += fm.statement(initializer, indent)
+	} else {
+		header += ";"
+	}
+	// A missing condition is parsed as true at the position of the keyword.
+	if literal, ok := loop.condition.(*Literal); !ok || fm.text(literal.loc) != "for" {
+		header += " " + fm.expr(loop.condition, indent, col+len(header)+1)
+	}
+	header += ";"
+	if loop.increment != nil {
+		header += " " + fm.expr(loop.increment, indent, col+len(header)+1)
+	}
+	return header + ")" + fm.body(loop.body, indent)
+}
+
+// method prints a function declaration without its fun keyword, as it is
+// written for methods.
+func (fm *formatter) method(stmt Stmt, indent int) string {
+	function := stmt.(Func)
+	return function.name.lexeme + parameter_list(function.params) + " " +
+		fm.block(function.body, indent, function.loc.end.offset)
+}
+
+// expr prints expr, which starts at column col of a line indented by
+// indent.
+func (fm *formatter) expr(expr Expr, indent int, col int) string {
+	switch t := expr.(type) {
+	case *Assign:
+		prefix := t.name.lexeme + " = "
+		return prefix + fm.expr(t.value, indent, col+width(prefix))
+	case *Binary:
+		return fm.binary(t.left, t.operator, t.right, indent, col)
+	case *Logical:
+		return fm.binary(t.left, t.operator, t.right, indent, col)
+	case *Call:
+		callee := fm.expr(t.callee, indent, col)
+		from := fm.opening(t.callee.span().end.offset, '(')
+		bounds := Span{Position{offset: from}, t.paren.span.end}
+		return callee + fm.sequence("(", ")", t.arguments, nil, bounds, indent, last_column(callee, col))
+	case *Get:
+		object := fm.expr(t.object, indent, col)
+		return object + "." + t.name.lexeme
+	case *Set:
+		object := fm.expr(t.object, indent, col)
+		prefix := object + "." + t.name.lexeme + " = "
+		return prefix + fm.expr(t.value, indent, last_column(prefix, col))
+	case *Index:
+		object := fm.expr(t.object, indent, col)
+		return object + "[" + fm.expr(t.index, indent, last_column(object, col)+1) + "]"
+	case *SetIndex:
+		object := fm.expr(t.object, indent, col)
+		prefix := object + "[" + fm.expr(t.index, indent, last_column(object, col)+1) + "] = "
+		return prefix + fm.expr(t.value, indent, last_column(prefix, col))
+	case *Grouping:
+		return "(" + fm.expr(t.expression, indent, col+1) + ")"
+	case *Lambda:
+		return fm.lambda(t, indent)
+	case *List:
+		return fm.sequence("[", "]", t.elements, nil, t.loc, indent, col)
+	case *Map:
+		return fm.sequence("{", "}", t.keys, t.values, t.loc, indent, col)
+	case *Literal:
+		return fm.text(t.loc)
+	case *Super:
+		return "super." + t.method.lexeme
+	case *This:
+		return "this"
+	case *Unary:
+		return t.operator.lexeme + fm.expr(t.right, indent, col+1)
+	case *Variable:
+		return t.name.lexeme
+	}
+	return fm.text(expr.span())
+}
+
+func (fm *formatter) binary(left Expr, operator Token, right Expr, indent int, col int) string {
+	out := fm.expr(left, indent, col) + " " + operator.lexeme + " "
+	return out + fm.expr(right, indent, last_column(out, col))
+}
+
+// lambda prints an anonymous function in the form it was written in:
+// fun (a) { ... }, (a) => { ... } or (a) => expr.
+func (fm *formatter) lambda(lambda *Lambda, indent int) string {
+	function := lambda.function
+	params := parameter_list(function.params)
+	if strings.HasPrefix(fm.text(function.loc), "fun") {
+		return "fun " + params + " " + fm.block(function.body, indent, function.loc.end.offset)
+	}
+	if len(function.body) == 1 {
+		if ret, ok := function.body[0].(Return); ok && ret.keyword.t_type == ARROW {
+			return params + " => " + fm.expr(ret.value, indent, 0)
+		}
+	}
+	return params + " => " + fm.block(function.body, indent, function.loc.end.offset)
+}
+
+// sequence prints the arguments of a call or the elements of a list, or
+// the entries of a map when values is not nil, between the brackets at
+// bounds. When they do not fit on the line, or there are comments between
+// them, each goes on a line of its own, and the comments are kept beside
+// or above the items they were written beside or above.
+func (fm *formatter) sequence(open string, close string, items []Expr, values []Expr, bounds Span, indent int, col int) string {
+	fm.misplaced(bounds.start.offset)
+	if len(items) == 0 && !fm.commented(items, values, bounds.end.offset) {
+		return open + close
+	}
+	mark := fm.next
+	if !fm.commented(items, values, bounds.end.offset) {
+		flat := open
+		for i := range items {
+			if i > 0 {
+				flat += ", "
+			}
+			flat += fm.item(items, values, i, indent, last_column(flat, col))
+		}
+		flat += close
+		// Sequences holding a multi-line function keep it hugging the brackets.
+		if strings.Contains(flat, "\n") || col+width(flat) <= format_width {
+			return flat
+		}
+		fm.next = mark
+	}
+	var broken strings.Builder
+	broken.WriteString(open + "\n")
+	last_line := -1
+	for i := range items {
+		start, end := item_bounds(items, values, i)
+		fm.comments_before(&broken, start.offset, indent+1, &last_line)
+		line := pad(indent+1) + fm.item(items, values, i, indent+1, len(pad(indent+1)))
+		if i < len(items)-1 {
+			line += ","
+		}
+		fm.misplaced(end.offset)
+		if fm.next < len(fm.comments) && fm.comments[fm.next].span.start.line == end.line &&
+			fm.comments[fm.next].span.start.offset < bounds.end.offset {
+			line += " " + fm.comments[fm.next].text
+			fm.next++
+		}
+		broken.WriteString(line + "\n")
+		last_line = end.line
+	}
+	fm.comments_before(&broken, bounds.end.offset, indent+1, &last_line)
+	return broken.String() + pad(indent) + close
+}
+
+// commented reports whether a comment before end lies between the items
+// rather than inside one of them.
+func (fm *formatter) commented(items []Expr, values []Expr, end int) bool {
+	for _, comment := range fm.comments[fm.next:] {
+		offset := comment.span.start.offset
+		if offset >= end {
+			return false
+		}
+		inside := false
+		for i := range items {
+			start, end := item_bounds(items, values, i)
+			inside = inside || start.offset <= offset && offset < end.offset
+		}
+		if !inside {
+			return true
+		}
+	}
+	return false
+}
+
+// item_bounds returns where the item i of a sequence starts and ends.
+func item_bounds(items []Expr, values []Expr, i int) (Position, Position) {
+	if values == nil {
+		return items[i].span().start, items[i].span().end
+	}
+	return items[i].span().start, values[i].span().end
+}
+
+func (fm *formatter) item(items []Expr, values []Expr, i int, indent int, col int) string {
+	if values == nil {
+		return fm.expr(items[i], indent, col)
+	}
+	key := fm.expr(items[i], indent, col) + ": "
+	return key + fm.expr(values[i], indent, last_column(key, col))
+}
+
+// width is the number of columns text takes up.
+func width(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// last_column returns the column after text, when text begins at col.
+func last_column(text string, col int) int {
+	if newline := strings.LastIndexByte(text, '\n'); newline >= 0 {
+		return width(text[newline+1:])
+	}
+	return col + width(text)
+}
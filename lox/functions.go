@@ -0,0 +1,233 @@
+package lox
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+type LoxCallable interface {
+	call(interp *Interpreter, arguments []Value) (Value, error)
+	arity() int
+}
+
+// Variadic is the arity of callables that accept any number of arguments.
+const Variadic = -1
+
+// Global functions
+
+type Clock struct{}
+
+func (cl Clock) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return float64(time.Now().UnixNano()) / 1e9, nil
+}
+
+func (cl Clock) arity() int {
+	return 0
+}
+
+func (cl Clock) String() string {
+	return "<native fn>"
+}
+
+type ToString struct{}
+
+func (ts ToString) call(interp *Interpreter, arguments []Value) (Value, error) {
+	str := fmt.Sprintf("%v", arguments[0])
+	if err := interp.allocate(&interp.memory.Strings, string_size+len(str)); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+func (ts ToString) arity() int {
+	return 1
+}
+
+func (ts ToString) String() string {
+	return "<native fn>"
+}
+
+// MathFunc is a native of the math library. Every argument must be a
+// number, which is checked before function is called.
+type MathFunc struct {
+	name     string
+	n_params int
+	function func(arguments []float64) Value
+}
+
+func (mf MathFunc) call(interp *Interpreter, arguments []Value) (Value, error) {
+	numbers := make([]float64, len(arguments))
+	for i, argument := range arguments {
+		number, ok := argument.(float64)
+		if !ok && mf.n_params == 1 {
+			return nil, fmt.Errorf("Argument to '%s' must be a number.", mf.name)
+		} else if !ok {
+			return nil, fmt.Errorf("Arguments to '%s' must be numbers.", mf.name)
+		}
+		numbers[i] = number
+	}
+	return mf.function(numbers), nil
+}
+
+func (mf MathFunc) arity() int {
+	return mf.n_params
+}
+
+func (mf MathFunc) String() string {
+	return "<native fn>"
+}
+
+// math_unary wraps a Go function of one number as a math native.
+func math_unary(name string, function func(float64) float64) MathFunc {
+	return MathFunc{name, 1, func(arguments []float64) Value {
+		return function(arguments[0])
+	}}
+}
+
+// math_binary wraps a Go function of two numbers as a math native.
+func math_binary(name string, function func(float64, float64) float64) MathFunc {
+	return MathFunc{name, 2, func(arguments []float64) Value {
+		return function(arguments[0], arguments[1])
+	}}
+}
+
+// math_globals returns the math natives and constants.
+func math_globals() map[string]Value {
+	globals := map[string]Value{
+		"PI":    math.Pi,
+		"E":     math.E,
+		"isNaN": MathFunc{"isNaN", 1, func(arguments []float64) Value { return math.IsNaN(arguments[0]) }},
+		"isInf": MathFunc{"isInf", 1, func(arguments []float64) Value { return math.IsInf(arguments[0], 0) }},
+	}
+	natives := []MathFunc{
+		math_unary("sqrt", math.Sqrt),
+		math_unary("abs", math.Abs),
+		math_unary("floor", math.Floor),
+		math_unary("ceil", math.Ceil),
+		math_unary("round", math.Round),
+		math_unary("sin", math.Sin),
+		math_unary("cos", math.Cos),
+		math_unary("tan", math.Tan),
+		math_unary("log", math.Log),
+		math_unary("exp", math.Exp),
+		math_binary("pow", math.Pow),
+		math_binary("atan2", math.Atan2),
+		math_binary("min", math.Min),
+		math_binary("max", math.Max),
+	}
+	for _, native := range natives {
+		globals[native.name] = native
+	}
+	return globals
+}
+
+// NativeFunc is the signature of Go functions exposed to Lox. Arguments
+// arrive as Lox values: float64, string, bool, nil or a Lox object.
+type NativeFunc func(arguments []Value) (Value, error)
+
+// Type representing Go functions registered through DefineNative
+type Native struct {
+	name     string
+	n_params int
+	function NativeFunc
+}
+
+func (nt Native) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return nt.function(arguments)
+}
+
+func (nt Native) arity() int {
+	return nt.n_params
+}
+
+func (nt Native) String() string {
+	return "<native fn>"
+}
+
+// Type representing the methods of lists and maps that need the
+// interpreter, to account for the memory they allocate.
+type native_method struct {
+	name     string
+	n_params int
+	function func(interp *Interpreter, arguments []Value) (Value, error)
+}
+
+func (nm native_method) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return nm.function(interp, arguments)
+}
+
+func (nm native_method) arity() int {
+	return nm.n_params
+}
+
+func (nm native_method) String() string {
+	return "<native fn>"
+}
+
+// DefineNative makes function available to scripts as the global name.
+// Pass Variadic as arity to accept any number of arguments. An error
+// returned by function is raised as a runtime error at the call site.
+func (interp *Interpreter) DefineNative(name string, arity int, function NativeFunc) {
+	interp.builtins.define(name, Native{name, arity, function})
+}
+
+// Type representing Lox functions
+type LoxFunction struct {
+	declaration Func
+	closure     *Environment
+	globals     *Environment
+	is_init     bool
+}
+
+func (lf LoxFunction) call(interp *Interpreter, arguments []Value) (Value, error) {
+	bytes := environment_size + variable_size*len(arguments)
+	if err := interp.allocate(&interp.memory.Environments, bytes); err != nil {
+		return nil, err
+	}
+	// Globals are looked up in the module the function was declared in.
+	enclosing := interp.globals
+	interp.globals = lf.globals
+	defer func() { interp.globals = enclosing }()
+	interp.push_frame(lf.declaration.name.lexeme, lf.declaration.file)
+	defer interp.pop_frame()
+	func_env := Environment{lf.closure, make(map[string]Value)}
+	for i := 0; i < len(lf.declaration.params); i++ {
+		func_env.define(lf.declaration.params[i].lexeme, arguments[i])
+	}
+	err := interp.execute_block(lf.declaration.body, &func_env)
+	if err != nil {
+		if return_val, ok := err.(ReturnVal); ok {
+			if lf.is_init {
+				return lf.closure.get_at(0, "this"), nil
+			}
+			return return_val.value, nil
+		}
+		interp.capture_trace(interp.frames, err)
+		return nil, err
+	}
+	if lf.is_init {
+		return lf.closure.get_at(0, "this"), nil
+	}
+	return nil, nil
+}
+
+func (lf LoxFunction) bind(instance LoxInstance) LoxCallable {
+	new_env := Environment{lf.closure, make(map[string]Value)}
+	new_env.define("this", instance)
+	return LoxFunction{lf.declaration, &new_env, lf.globals, lf.is_init}
+}
+
+// receiver returns the instance a method was bound to, if it was.
+func (lf LoxFunction) receiver() (Value, bool) {
+	this, ok := lf.closure.values["this"]
+	return this, ok
+}
+
+func (lf LoxFunction) arity() int {
+	return len(lf.declaration.params)
+}
+
+func (lf LoxFunction) String() string {
+	return "<fn " + lf.declaration.name.lexeme + ">"
+}
@@ -0,0 +1,814 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+)
+
+type RuntimeError struct {
+	message string
+	token   Token
+}
+
+func (re RuntimeError) Error() string {
+	return re.message
+}
+
+type ReturnVal struct {
+	value Value
+}
+
+func (rv ReturnVal) Error() string {
+	return stringify(rv.value)
+}
+
+// LoopJump unwinds the body of the innermost loop for a break or continue
+// statement, the same way ReturnVal unwinds a function body.
+type LoopJump struct {
+	keyword Token
+}
+
+func (lj LoopJump) Error() string {
+	return lj.keyword.lexeme
+}
+
+// Interpreter owns all of the state needed to run Lox code: the global
+// environment, the resolver's side table and the error flags. Separate
+// interpreters share nothing and may be used side by side.
+type Interpreter struct {
+	*reporter
+	// builtins holds the natives and host bindings seen by every module,
+	// and globals the top level of the module currently running.
+	builtins  *Environment
+	globals   *Environment
+	modules   map[string]*Module
+	loading   []string
+	locals    map[Expr]int
+	run_error bool
+	in_repl   bool
+	stdout    io.Writer
+	backend   Backend
+	vm        *VM
+	// frames is the call stack of the tree-walking backend, and trace the
+	// stack captured for the error currently unwinding, outermost first.
+	frames []trace_frame
+	trace  []trace_frame
+	// debugger, when set, is told about every statement and expression
+	// before it runs.
+	debugger *debugger
+	// limits bounds every run, and the fields after it track the run in
+	// progress. limited is set when any step could hit a limit.
+	limits   Limits
+	limited  bool
+	ctx      context.Context
+	deadline time.Time
+	steps    int
+	stopped  error
+	// memory estimates what the run in progress has allocated.
+	memory MemoryStats
+	// capabilities are the modules of natives granted to scripts, and
+	// denied gives the reason each native that was not is unavailable.
+	capabilities []Capability
+	denied       map[string]string
+}
+
+// Backend selects how an Interpreter executes programs.
+type Backend int
+
+const (
+	// TreeWalk evaluates the syntax tree directly.
+	TreeWalk Backend = iota
+	// Bytecode compiles the syntax tree and runs it on a stack VM.
+	Bytecode
+)
+
+// Option configures an Interpreter created by NewInterpreter.
+type Option func(*Interpreter)
+
+// WithStdout sends the output of print statements to w.
+func WithStdout(w io.Writer) Option {
+	return func(interp *Interpreter) {
+		interp.stdout = w
+	}
+}
+
+// WithStderr sends error reports to w.
+func WithStderr(w io.Writer) Option {
+	return func(interp *Interpreter) {
+		interp.reporter.out = w
+	}
+}
+
+// WithBackend selects the execution backend. The default is TreeWalk.
+func WithBackend(backend Backend) Option {
+	return func(interp *Interpreter) {
+		interp.backend = backend
+	}
+}
+
+// WithRepl makes expression statements print their value, as in a REPL.
+func WithRepl() Option {
+	return func(interp *Interpreter) {
+		interp.in_repl = true
+	}
+}
+
+func NewInterpreter(options ...Option) *Interpreter {
+	global_funcs := math_globals()
+	global_funcs["string"] = ToString{}
+	builtins := &Environment{values: global_funcs}
+	interp := &Interpreter{
+		reporter: &reporter{out: os.Stderr},
+		builtins: builtins,
+		globals:  &Environment{builtins, make(map[string]Value)},
+		modules:  make(map[string]*Module),
+		locals:   make(map[Expr]int),
+		stdout:   os.Stdout,
+	}
+	for _, option := range options {
+		option(interp)
+	}
+	interp.grant()
+	return interp
+}
+
+func (interp *Interpreter) interpret(statements []Stmt, file string) error {
+	curr_env := interp.globals
+	interp.trace = nil
+	interp.push_frame("<script>", file)
+	defer interp.pop_frame()
+	for _, stmt := range statements {
+		err := interp.execute(stmt, curr_env)
+		if _, ok := err.(debug_quit); ok {
+			return err
+		}
+		if err != nil {
+			interp.capture_trace(interp.frames, err)
+			interp.runtime_error(uncaught(err))
+			return err
+		}
+	}
+	return nil
+}
+
+func (interp *Interpreter) execute(stmt Stmt, curr_env *Environment) error {
+	if interp.limited {
+		if err := interp.tick(stmt.span().start.line); err != nil {
+			return err
+		}
+	}
+	if interp.debugger != nil {
+		if err := interp.debugger.reach(stmt.span(), curr_env); err != nil {
+			return err
+		}
+	}
+	switch t := stmt.(type) {
+	case Print:
+		value, err := interp.evaluate(t.expr, curr_env)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(interp.stdout, stringify(value))
+		return nil
+	case Expression:
+		value, err := interp.evaluate(t.expr, curr_env)
+		if err != nil {
+			return err
+		}
+		// Not the best way to do this but it works for now. Find a better way in the rewrite?
+		if interp.in_repl {
+			fmt.Fprintln(interp.stdout, stringify(value))
+		}
+		return nil
+	case Block:
+		brace := line_token(LEFT_BRACE, "{", t.loc.start.line)
+		if err := interp.allocate_at(brace, &interp.memory.Environments, environment_size); err != nil {
+			return err
+		}
+		block_env := Environment{enclosing: curr_env, values: make(map[string]Value)}
+		err := interp.execute_block(t.statements, &block_env)
+		if err != nil {
+			return err
+		}
+		return nil
+	case Class:
+		var superclass *LoxClass
+		if t.superclass != nil {
+			val, err := interp.evaluate(t.superclass, curr_env)
+			if err != nil {
+				return err
+			}
+			if sup, ok := val.(LoxClass); !ok {
+				return RuntimeError{"Superclass must be a class", t.superclass.name}
+			} else {
+				superclass = &sup
+			}
+		}
+		curr_env.define(t.name.lexeme, nil)
+		if t.superclass != nil {
+			if err := interp.allocate_at(t.name, &interp.memory.Environments, environment_size+variable_size); err != nil {
+				return err
+			}
+			curr_env = &Environment{curr_env, make(map[string]Value)}
+			curr_env.define("super", superclass)
+		}
+		methods := make(map[string]Method)
+		for _, m := range t.methods {
+			if err := interp.allocate_at(m.name, &interp.memory.Closures, closure_size); err != nil {
+				return err
+			}
+			is_init := m.name.lexeme == "init"
+			function := LoxFunction{m, curr_env, interp.globals, is_init}
+			methods[m.name.lexeme] = function
+		}
+		klass := LoxClass{t.name.lexeme, superclass, methods}
+		curr_env.assign(t.name, klass)
+		return nil
+	case If:
+		val, err := interp.evaluate(t.condition, curr_env)
+		if err != nil {
+			return err
+		}
+		if is_truthy(val) {
+			return interp.execute(t.then_branch, curr_env)
+		} else if t.else_branch != nil {
+			return interp.execute(t.else_branch, curr_env)
+		}
+		return nil
+	case While:
+		for {
+			val, err := interp.evaluate(t.condition, curr_env)
+			if err != nil {
+				return err
+			}
+			if !is_truthy(val) {
+				break
+			}
+			err = interp.execute(t.body, curr_env)
+			if jump, ok := err.(LoopJump); ok {
+				if jump.keyword.t_type == BREAK {
+					break
+				}
+			} else if err != nil {
+				return err
+			}
+			if t.increment != nil {
+				if _, err = interp.evaluate(t.increment, curr_env); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case Import:
+		interp.frames[len(interp.frames)-1].line = t.keyword.line
+		module, err := interp.import_module(t.keyword, t.path, t.file)
+		if err != nil {
+			return err
+		}
+		curr_env.define(t.name.lexeme, module)
+		return nil
+	case Throw:
+		value, err := interp.evaluate(t.value, curr_env)
+		if err != nil {
+			return err
+		}
+		return ThrowVal{value, t.keyword}
+	case Try:
+		err := interp.execute(t.body, curr_env)
+		if err != nil && t.catch != nil {
+			if value, ok := caught_value(err); ok && !interp.out_of_memory() {
+				interp.trace = nil
+				err = interp.allocate_at(t.catch.name, &interp.memory.Environments, environment_size+variable_size)
+				if err != nil {
+					return err
+				}
+				catch_env := &Environment{curr_env, make(map[string]Value)}
+				catch_env.define(t.catch.name.lexeme, value)
+				err = interp.execute_block(t.catch.body, catch_env)
+			}
+		}
+		if t.finally != nil {
+			// An error or jump out of the finally clause replaces err.
+			trace := interp.trace
+			interp.trace = nil
+			if finally_err := interp.execute(*t.finally, curr_env); finally_err != nil {
+				return finally_err
+			}
+			interp.trace = trace
+		}
+		return err
+	case Break:
+		return LoopJump{t.keyword}
+	case Continue:
+		return LoopJump{t.keyword}
+	case Var:
+		var value Value
+		var err error
+		if t.initializer != nil {
+			value, err = interp.evaluate(t.initializer, curr_env)
+			if err != nil {
+				return err
+			}
+		}
+		if err := interp.allocate_at(t.name, &interp.memory.Environments, variable_size); err != nil {
+			return err
+		}
+		curr_env.define(t.name.lexeme, value)
+		return nil
+	case Func:
+		if err := interp.allocate_at(t.name, &interp.memory.Closures, closure_size); err != nil {
+			return err
+		}
+		lox_func := LoxFunction{t, curr_env, interp.globals, false}
+		curr_env.define(t.name.lexeme, lox_func)
+		return nil
+	case Return:
+		var value Value
+		var err error
+		if t.value != nil {
+			value, err = interp.evaluate(t.value, curr_env)
+			if err != nil {
+				return err
+			}
+		}
+		return ReturnVal{value}
+	}
+	return RuntimeError{message: "Internal error, unknown statement type encountered"}
+}
+
+func (interp *Interpreter) execute_block(statements []Stmt, block_env *Environment) error {
+	for _, stmt := range statements {
+		err := interp.execute(stmt, block_env)
+		if err != nil {
+			// this used to break
+			return err
+		}
+	}
+	return nil
+}
+
+func (interp *Interpreter) evaluate(exp Expr, curr_env *Environment) (Value, error) {
+	if interp.limited {
+		if err := interp.tick(exp.span().start.line); err != nil {
+			return nil, err
+		}
+	}
+	if interp.debugger != nil {
+		if err := interp.debugger.reach(exp.span(), curr_env); err != nil {
+			return nil, err
+		}
+	}
+	switch t := exp.(type) {
+	case *Literal:
+		return t.value, nil
+	case *Get:
+		object, err := interp.evaluate(t.object, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		return get_property(object, t.name)
+	case *Set:
+		object, err := interp.evaluate(t.object, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		val, err := interp.evaluate(t.value, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		if err := interp.allocate_store(object, t.name.lexeme, t.name); err != nil {
+			return nil, err
+		}
+		if err := set_property(object, t.name, val); err != nil {
+			return nil, err
+		}
+		return val, nil
+	case *Lambda:
+		if err := interp.allocate_at(t.function.name, &interp.memory.Closures, closure_size); err != nil {
+			return nil, err
+		}
+		return LoxFunction{t.function, curr_env, interp.globals, false}, nil
+	case *List:
+		elements := make([]Value, 0, len(t.elements))
+		for _, element := range t.elements {
+			val, err := interp.evaluate(element, curr_env)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, val)
+		}
+		if err := interp.allocate_at(t.bracket, &interp.memory.Collections, list_size+element_size*len(elements)); err != nil {
+			return nil, err
+		}
+		return &LoxList{elements}, nil
+	case *Map:
+		keys := make([]Value, len(t.keys))
+		values := make([]Value, len(t.values))
+		for i := range t.keys {
+			key, err := interp.evaluate(t.keys[i], curr_env)
+			if err != nil {
+				return nil, err
+			}
+			val, err := interp.evaluate(t.values[i], curr_env)
+			if err != nil {
+				return nil, err
+			}
+			keys[i], values[i] = key, val
+		}
+		if err := interp.allocate_at(t.brace, &interp.memory.Collections, map_size); err != nil {
+			return nil, err
+		}
+		entries := new_lox_map()
+		for i, key := range keys {
+			if err := interp.allocate_store(entries, key, t.brace); err != nil {
+				return nil, err
+			}
+			if err := check_key(t.brace, key); err != nil {
+				return nil, err
+			}
+			entries.store(key, values[i])
+		}
+		return entries, nil
+	case *Index:
+		object, err := interp.evaluate(t.object, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		index, err := interp.evaluate(t.index, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		return get_index(object, t.bracket, index)
+	case *SetIndex:
+		object, err := interp.evaluate(t.object, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		index, err := interp.evaluate(t.index, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		val, err := interp.evaluate(t.value, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		if err := interp.allocate_store(object, index, t.bracket); err != nil {
+			return nil, err
+		}
+		if err := set_index(object, t.bracket, index, val); err != nil {
+			return nil, err
+		}
+		return val, nil
+	case *This:
+		return interp.lookup_var(t.keyword, t, curr_env)
+	case *Super:
+		distance := interp.locals[t]
+		superclass := curr_env.get_at(distance, "super").(*LoxClass)
+		object := curr_env.get_at(distance-1, "this").(LoxInstance)
+		method, ok := superclass.find_method(t.method.lexeme)
+		if ok {
+			return method.bind(object), nil
+		} else {
+			return nil, RuntimeError{"Undefined property '" + t.method.lexeme + "'.", t.method}
+		}
+	case *Grouping:
+		return interp.evaluate(t.expression, curr_env)
+	case *Unary:
+		right, r_err := interp.evaluate(t.right, curr_env)
+		if r_err != nil {
+			return nil, r_err
+		}
+		return unary_op(t.operator, right)
+	case *Variable:
+		return interp.lookup_var(t.name, t, curr_env)
+	case *Logical:
+		left, err := interp.evaluate(t.left, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		if t.operator.t_type == OR {
+			if is_truthy(left) {
+				return left, nil
+			}
+		} else if !is_truthy(left) {
+			return left, nil
+		}
+		return interp.evaluate(t.right, curr_env)
+	case *Assign:
+		value, err := interp.evaluate(t.value, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		// fmt.Println("Going to assign: ", t.name, value)
+		if distance, ok := interp.locals[t]; ok {
+			curr_env.assign_at(distance, t.name, value)
+		} else {
+			err := interp.globals.assign(t.name, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	case *Call:
+		callee, err := interp.evaluate(t.callee, curr_env)
+		if err != nil {
+			return nil, err
+		}
+		var arguments []Value
+		for _, arg := range t.arguments {
+			val, err := interp.evaluate(arg, curr_env)
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, val)
+		}
+		interp.frames[len(interp.frames)-1].line = t.paren.line
+		return interp.call_value(callee, t.paren, arguments)
+	case *Binary:
+		left, l_err := interp.evaluate(t.left, curr_env)
+		if l_err != nil {
+			return nil, l_err
+		}
+		right, r_err := interp.evaluate(t.right, curr_env)
+		if r_err != nil {
+			return nil, r_err
+		}
+		value, err := binary_op(t.operator, left, right)
+		if err != nil {
+			return nil, err
+		}
+		if str, ok := value.(string); ok {
+			if err := interp.allocate_at(t.operator, &interp.memory.Strings, string_size+len(str)); err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	}
+	return nil, RuntimeError{message: "Internal error, unknown expr was passed in"}
+}
+
+func unary_op(operator Token, right Value) (Value, error) {
+	switch operator.t_type {
+	case MINUS:
+		if err := valid_number_operand(operator, right); err != nil {
+			return nil, err
+		}
+		return -right.(float64), nil
+	case BANG:
+		return !is_truthy(right), nil
+	}
+	return nil, RuntimeError{message: "Internal error, unknown unary operator"}
+}
+
+func binary_op(operator Token, left Value, right Value) (Value, error) {
+	switch operator.t_type {
+	case PLUS:
+		f_left, l_ok := left.(float64)
+		f_right, r_ok := right.(float64)
+		if l_ok && r_ok {
+			return f_left + f_right, nil
+		}
+		s_left, l_ok := left.(string)
+		s_right, r_ok := right.(string)
+		if l_ok && r_ok {
+			return s_left + s_right, nil
+		}
+		return nil, RuntimeError{"Operands must be two numbers or two strings", operator}
+	case MINUS:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) - right.(float64), nil
+	case SLASH:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) / right.(float64), nil
+	case STAR:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) * right.(float64), nil
+	case GREATER:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) > right.(float64), nil
+	case GREATER_EQUAL:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) >= right.(float64), nil
+	case LESS:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) < right.(float64), nil
+	case LESS_EQUAL:
+		if err := valid_number_operands(operator, left, right); err != nil {
+			return nil, err
+		}
+		return left.(float64) <= right.(float64), nil
+	case BANG_EQUAL:
+		return !is_equal(left, right), nil
+	case EQUAL_EQUAL:
+		return is_equal(left, right), nil
+	}
+	return nil, RuntimeError{message: "Internal error, unknown binary operator"}
+}
+
+func get_property(object Value, name Token) (Value, error) {
+	switch inst := object.(type) {
+	case LoxInstance:
+		return inst.get(name)
+	case GoInstance:
+		return inst.get(name)
+	case *LoxList:
+		return inst.get(name)
+	case *LoxMap:
+		return inst.get(name)
+	case *LoxError:
+		return inst.get(name)
+	case *Module:
+		return inst.get(name)
+	case string:
+		return string_method(inst, name)
+	}
+	return nil, RuntimeError{"Only instances have properties", name}
+}
+
+func set_property(object Value, name Token, val Value) error {
+	switch inst := object.(type) {
+	case LoxInstance:
+		inst.set(name, val)
+		return nil
+	case GoInstance:
+		return inst.set(name, val)
+	}
+	return RuntimeError{"Only instance have fields.", name}
+}
+
+func get_index(object Value, bracket Token, index Value) (Value, error) {
+	switch container := object.(type) {
+	case string:
+		return string_index(container, bracket, index)
+	case *LoxList:
+		i, err := container.position(bracket, index)
+		if err != nil {
+			return nil, err
+		}
+		return container.elements[i], nil
+	case *LoxMap:
+		if err := check_key(bracket, index); err != nil {
+			return nil, err
+		}
+		if val, ok := container.lookup(index); ok {
+			return val, nil
+		}
+		return nil, RuntimeError{"Undefined key " + stringify_nested(index, nil) + ".", bracket}
+	}
+	return nil, RuntimeError{"Only lists, maps and strings can be indexed.", bracket}
+}
+
+func set_index(object Value, bracket Token, index Value, val Value) error {
+	switch container := object.(type) {
+	case *LoxList:
+		i, err := container.position(bracket, index)
+		if err != nil {
+			return err
+		}
+		container.elements[i] = val
+		return nil
+	case *LoxMap:
+		if err := check_key(bracket, index); err != nil {
+			return err
+		}
+		container.store(index, val)
+		return nil
+	case string:
+		return RuntimeError{"Strings can't be modified.", bracket}
+	}
+	return RuntimeError{"Only lists and maps can be indexed.", bracket}
+}
+
+func (interp *Interpreter) call_value(callee Value, paren Token, arguments []Value) (Value, error) {
+	lox_func, ok := callee.(LoxCallable)
+	if !ok {
+		return nil, RuntimeError{"Can only call functions and classes", paren}
+	}
+	if lox_func.arity() != Variadic && lox_func.arity() != len(arguments) {
+		msg := fmt.Sprintf("Expected %d arguments but got %d.", lox_func.arity(), len(arguments))
+		return nil, RuntimeError{msg, paren}
+	}
+	if err := interp.check_depth(len(interp.frames), paren.line); err != nil {
+		return nil, err
+	}
+	value, err := lox_func.call(interp, arguments)
+	if err != nil {
+		switch err.(type) {
+		case RuntimeError, ThrowVal, LimitError, debug_quit:
+			return nil, err
+		}
+		// A native that failed because the run's context is done, such as
+		// exec past the timeout, stops the run rather than raising an error
+		// the script could catch.
+		if interp.limited && interp.stopped == nil {
+			interp.stopped = interp.context_error(paren.line)
+		}
+		if interp.stopped != nil {
+			return nil, interp.stopped
+		}
+		return nil, RuntimeError{err.Error(), paren}
+	}
+	return value, nil
+}
+
+func (interp *Interpreter) set_scope(expr Expr, depth int) {
+	interp.locals[expr] = depth
+}
+
+func (interp *Interpreter) lookup_var(name Token, expr Expr, curr_env *Environment) (Value, error) {
+	if distance, ok := interp.locals[expr]; ok {
+		return curr_env.get_at(distance, name.lexeme), nil
+	} else {
+		return interp.get_global(interp.globals, name)
+	}
+}
+
+func is_truthy(val Value) bool {
+	if val == nil {
+		return false
+	}
+	if b_val, ok := val.(bool); ok {
+		return b_val
+	}
+	return true
+}
+
+func is_equal(val_one Value, val_two Value) bool {
+	if val_one == nil && val_two == nil {
+		return true
+	}
+	if val_one == nil {
+		return false
+	}
+	// Objects holding maps or slices are not comparable with ==, so they
+	// are compared by identity instead.
+	switch one := val_one.(type) {
+	case LoxInstance:
+		two, ok := val_two.(LoxInstance)
+		return ok && same_map(one.fields, two.fields)
+	case LoxClass:
+		two, ok := val_two.(LoxClass)
+		return ok && same_map(one.methods, two.methods)
+	case LoxFunction:
+		two, ok := val_two.(LoxFunction)
+		if !ok || one.declaration.name != two.declaration.name {
+			return false
+		}
+		if one.closure == two.closure {
+			return true
+		}
+		// A method is bound afresh on every access, so bound methods are
+		// equal when they bind the same method to the same instance, as
+		// BoundMethod values are in the VM.
+		this_one, one_bound := one.receiver()
+		this_two, two_bound := two.receiver()
+		return one_bound && two_bound && one.closure.enclosing == two.closure.enclosing && is_equal(this_one, this_two)
+	case BoundMethod:
+		two, ok := val_two.(BoundMethod)
+		return ok && one.method == two.method && same_map(one.receiver.fields, two.receiver.fields)
+	}
+	return val_one == val_two
+}
+
+func same_map(one interface{}, two interface{}) bool {
+	return reflect.ValueOf(one).UnsafePointer() == reflect.ValueOf(two).UnsafePointer()
+}
+
+func valid_number_operand(operator Token, operand Value) error {
+	if _, ok := operand.(float64); ok {
+		return nil
+	}
+	return RuntimeError{"Operand must be a number", operator}
+}
+
+func valid_number_operands(operator Token, left Value, right Value) error {
+	_, l_ok := left.(float64)
+	_, r_ok := right.(float64)
+	if l_ok && r_ok {
+		return nil
+	}
+	return RuntimeError{"Operands must be two numbers or string", operator}
+}
+
+func stringify(value Value) string {
+	if value == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -1,49 +1,72 @@
-package main
+package lox
 
 import (
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 var keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"return": RETURN,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"return":   RETURN,
+	"while":    WHILE,
+}
+
+// Comment is the text of a // comment, which the lexer keeps as trivia
+// beside the tokens so that the formatter can put it back.
+type Comment struct {
+	text string
+	span Span
 }
 
 type Lexer struct {
-	source  string
-	tokens  []Token
-	start   int
-	current int
-	line    int
+	source     string
+	tokens     []Token
+	comments   []Comment
+	start      int
+	current    int
+	line       int
+	line_start int
+	start_pos  Position
+	reporter   *reporter
 }
 
-func NewLexer(source string) *Lexer {
+func NewLexer(source string, rp *reporter) *Lexer {
 	lexer := new(Lexer)
 	lexer.source = source
 	lexer.line = 1
+	lexer.reporter = rp
 	return lexer
 }
 
 func (lx *Lexer) scan_tokens() []Token {
 	for !lx.finished() {
 		lx.start = lx.current
+		lx.start_pos = lx.position()
 		lx.scan_token()
 	}
-	lx.tokens = append(lx.tokens, Token{EOF, "", nil, lx.line})
+	end := lx.position()
+	lx.tokens = append(lx.tokens, Token{EOF, "", nil, lx.line, Span{end, end}})
 	return lx.tokens
 }
 
@@ -58,8 +81,14 @@ func (lx *Lexer) scan_token() {
 		lx.add_token(LEFT_BRACE)
 	case '}':
 		lx.add_token(RIGHT_BRACE)
+	case '[':
+		lx.add_token(LEFT_BRACKET)
+	case ']':
+		lx.add_token(RIGHT_BRACKET)
 	case ',':
 		lx.add_token(COMMA)
+	case ':':
+		lx.add_token(COLON)
 	case '.':
 		lx.add_token(DOT)
 	case '-':
@@ -82,6 +111,8 @@ func (lx *Lexer) scan_token() {
 		var t_type TokenType
 		if lx.matched('=') {
 			t_type = EQUAL_EQUAL
+		} else if lx.matched('>') {
+			t_type = ARROW
 		} else {
 			t_type = EQUAL
 		}
@@ -107,6 +138,8 @@ func (lx *Lexer) scan_token() {
 			for lx.peek() != '\n' && !lx.finished() {
 				lx.advance()
 			}
+			text := strings.TrimRight(lx.source[lx.start:lx.current], " \t\r")
+			lx.comments = append(lx.comments, Comment{text, Span{lx.start_pos, lx.position()}})
 		} else {
 			lx.add_token(SLASH)
 		}
@@ -114,14 +147,14 @@ func (lx *Lexer) scan_token() {
 		lx.string()
 	case ' ', '\r', '\t':
 	case '\n':
-		lx.line++
+		lx.new_line()
 	default:
 		if lx.is_digit(c) {
 			lx.number()
 		} else if lx.is_alpha(c) {
 			lx.identifier()
 		} else {
-			line_error(lx.line, "Unexpected character.")
+			lx.error(code_unexpected_character, "Unexpected character.")
 		}
 	}
 }
@@ -132,7 +165,25 @@ func (lx *Lexer) add_token(t_type TokenType) {
 
 func (lx *Lexer) add_token_value(t_type TokenType, literal Value) {
 	text := lx.source[lx.start:lx.current]
-	lx.tokens = append(lx.tokens, Token{t_type, text, literal, lx.line})
+	span := Span{lx.start_pos, lx.position()}
+	lx.tokens = append(lx.tokens, Token{t_type, text, literal, lx.line, span})
+}
+
+// error reports an error covering the token being scanned.
+func (lx *Lexer) error(code string, message string) {
+	lx.reporter.error_at(Span{lx.start_pos, lx.position()}, code, message)
+}
+
+// position returns the position of the next character to be scanned.
+func (lx *Lexer) position() Position {
+	column := utf8.RuneCountInString(lx.source[lx.line_start:lx.current]) + 1
+	return Position{lx.line, column, lx.current}
+}
+
+// new_line is called once the newline before lx.current is consumed.
+func (lx *Lexer) new_line() {
+	lx.line++
+	lx.line_start = lx.current
 }
 
 func (lx *Lexer) advance() rune {
@@ -154,14 +205,14 @@ func (lx *Lexer) matched(expected rune) bool {
 
 func (lx *Lexer) string() {
 	for lx.peek() != '"' && !lx.finished() {
-		if lx.peek() == '\n' {
-			lx.line++
-		}
 		lx.advance()
+		if lx.previous() == '\n' {
+			lx.new_line()
+		}
 	}
 
 	if lx.finished() {
-		line_error(lx.line, "Unterminated string")
+		lx.error(code_unterminated_string, "Unterminated string")
 		return
 	}
 
@@ -204,6 +255,10 @@ func (lx Lexer) finished() bool {
 	return lx.current >= len(lx.source)
 }
 
+func (lx Lexer) previous() rune {
+	return rune(lx.source[lx.current-1])
+}
+
 func (lx Lexer) peek() rune {
 	if lx.finished() {
 		return '\000'
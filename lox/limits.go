@@ -0,0 +1,131 @@
+package lox
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultMaxDepth is the call depth allowed when Limits.MaxDepth is zero.
+// Deeper recursion would overflow the Go stack of the tree-walker.
+const DefaultMaxDepth = 10000
+
+// The context and the clock are only checked every limit_interval steps.
+const limit_interval = 1024
+
+// The errors wrapped by a LimitError, telling which limit stopped a run.
+// A run stopped by its context wraps the error of the context instead.
+var (
+	ErrStepLimit  = errors.New("Step limit exceeded")
+	ErrTimeLimit  = errors.New("Time limit exceeded")
+	ErrDepthLimit = errors.New("Call depth limit exceeded")
+)
+
+// Limits bounds the work a single run may do. Zero fields other than
+// MaxDepth mean no limit.
+type Limits struct {
+	// MaxSteps is the number of statements and expressions the
+	// tree-walker may evaluate, or of instructions the VM may execute.
+	MaxSteps int
+	// Timeout is the wall-clock time a run may take.
+	Timeout time.Duration
+	// MaxDepth is the number of calls that may be active at once,
+	// counting the script itself. Zero means DefaultMaxDepth.
+	MaxDepth int
+	// MaxMemory is the number of bytes a run may allocate, as estimated
+	// by MemoryStats. Going over it raises a runtime error.
+	MaxMemory int64
+}
+
+// WithLimits bounds every run of the interpreter by limits.
+func WithLimits(limits Limits) Option {
+	return func(interp *Interpreter) {
+		interp.limits = limits
+	}
+}
+
+// LimitError is returned by a run that was stopped by one of its Limits or
+// by its context. It cannot be caught by the script. Use errors.Is with
+// ErrStepLimit, ErrTimeLimit, ErrDepthLimit or the context's error to
+// tell why.
+type LimitError struct {
+	err  error
+	line int
+}
+
+func (le LimitError) Error() string {
+	switch le.err {
+	case ErrStepLimit, ErrTimeLimit, ErrDepthLimit:
+		return le.err.Error()
+	}
+	return "Execution stopped: " + le.err.Error()
+}
+
+func (le LimitError) Unwrap() error {
+	return le.err
+}
+
+// Line returns the line that was running when the run was stopped.
+func (le LimitError) Line() int {
+	return le.line
+}
+
+// start_limits resets the step count, clock and memory stats for a run
+// under ctx. The run's context carries the timeout, so that natives
+// waiting on it stop in time, and the returned function releases it once
+// the run ends.
+func (interp *Interpreter) start_limits(ctx context.Context) context.CancelFunc {
+	interp.steps, interp.stopped = 0, nil
+	interp.memory = MemoryStats{}
+	interp.deadline = time.Time{}
+	cancel := context.CancelFunc(func() {})
+	if interp.limits.Timeout > 0 {
+		interp.deadline = time.Now().Add(interp.limits.Timeout)
+		ctx, cancel = context.WithDeadline(ctx, interp.deadline)
+	}
+	interp.ctx = ctx
+	interp.limited = ctx.Done() != nil || interp.limits.MaxSteps > 0
+	return cancel
+}
+
+// tick counts a step at line, and returns a LimitError once the run must
+// stop. Every later step returns the same error, so that finally clauses
+// cannot keep a stopped run going.
+func (interp *Interpreter) tick(line int) error {
+	if interp.stopped != nil {
+		return interp.stopped
+	}
+	interp.steps++
+	if interp.limits.MaxSteps > 0 && interp.steps > interp.limits.MaxSteps {
+		interp.stopped = LimitError{ErrStepLimit, line}
+	} else if interp.steps%limit_interval == 0 {
+		interp.stopped = interp.context_error(line)
+	}
+	return interp.stopped
+}
+
+// context_error returns the LimitError for a run whose context is done at
+// line, or nil while it is not.
+func (interp *Interpreter) context_error(line int) error {
+	err := interp.ctx.Err()
+	if err == nil {
+		return nil
+	}
+	if !interp.deadline.IsZero() && !time.Now().Before(interp.deadline) {
+		return LimitError{ErrTimeLimit, line}
+	}
+	return LimitError{err, line}
+}
+
+// check_depth returns a LimitError when depth calls are already active
+// and another one, made at line, would exceed the limit.
+func (interp *Interpreter) check_depth(depth int, line int) error {
+	max_depth := interp.limits.MaxDepth
+	if max_depth == 0 {
+		max_depth = DefaultMaxDepth
+	}
+	if depth >= max_depth {
+		return LimitError{ErrDepthLimit, line}
+	}
+	return nil
+}
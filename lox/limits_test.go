@@ -0,0 +1,31 @@
+package lox
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestTimeoutStopsBlockingNative(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+	for _, backend := range []Backend{TreeWalk, Bytecode} {
+		var stdout, stderr bytes.Buffer
+		interp := NewInterpreter(WithBackend(backend), WithStdout(&stdout), WithStderr(&stderr),
+			WithCapabilities(AllowProcess()), WithLimits(Limits{Timeout: 200 * time.Millisecond}))
+		start := time.Now()
+		err := interp.Run(`try { exec("sleep", ["5"]); } catch (e) { print "caught"; } print "done";`)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("backend %d: run took %v past its timeout", backend, elapsed)
+		}
+		if !errors.Is(err, ErrTimeLimit) {
+			t.Errorf("backend %d: got error %v, want the time limit", backend, err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("backend %d: script kept running and printed %q", backend, stdout.String())
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package lox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lint_rule is one check of glox lint. Config files and lint comments
+// name a rule by its name or by its code.
+type lint_rule struct {
+	name string
+	code string
+}
+
+var (
+	rule_unused_variable    = lint_rule{"unused-variable", code_unused_variable}
+	rule_unreachable_code   = lint_rule{"unreachable-code", code_unreachable_code}
+	rule_shadowing          = lint_rule{"shadowing", code_shadowing}
+	rule_undeclared_global  = lint_rule{"undeclared-global", code_undeclared_global}
+	rule_init_return        = lint_rule{"init-return", code_init_return}
+	rule_constant_condition = lint_rule{"constant-condition", code_constant_condition}
+)
+
+var lint_rules = []lint_rule{
+	rule_unused_variable,
+	rule_unreachable_code,
+	rule_shadowing,
+	rule_undeclared_global,
+	rule_init_return,
+	rule_constant_condition,
+}
+
+func find_rule(name string) (lint_rule, bool) {
+	for _, rule := range lint_rules {
+		if rule.name == name || rule.code == name {
+			return rule, true
+		}
+	}
+	return lint_rule{}, false
+}
+
+// LintConfigFile is the name of the config file glox lint looks for in the
+// directory of each file it checks and in the directories above.
+const LintConfigFile = ".glox-lint.json"
+
+// LintConfig selects the rules glox lint checks. Every rule is enabled
+// unless Rules maps its name or code to false, as in
+//
+//	{"rules": {"shadowing": false}}
+type LintConfig struct {
+	Rules map[string]bool `json:"rules"`
+}
+
+func (lc LintConfig) enabled(rule lint_rule) bool {
+	if on, ok := lc.Rules[rule.name]; ok {
+		return on
+	}
+	if on, ok := lc.Rules[rule.code]; ok {
+		return on
+	}
+	return true
+}
+
+// LoadLintConfig reads the lint config file at path.
+func LoadLintConfig(path string) (LintConfig, error) {
+	var config LintConfig
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return config, fmt.Errorf("%s: %v", path, err)
+	}
+	for name := range config.Rules {
+		if _, ok := find_rule(name); !ok {
+			return config, fmt.Errorf("%s: unknown lint rule '%s'", path, name)
+		}
+	}
+	return config, nil
+}
+
+// FindLintConfig loads the LintConfigFile nearest to file, or returns the
+// default config when there is none.
+func FindLintConfig(file string) (LintConfig, error) {
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return LintConfig{}, err
+	}
+	for {
+		path := filepath.Join(dir, LintConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return LoadLintConfig(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return LintConfig{}, nil
+		}
+		dir = parent
+	}
+}
+
+// Lint checks source without running it and writes out the warnings of the
+// rules enabled by config, along with any errors that would stop it from
+// running. Warnings can also be turned off by lint comments in the source.
+func (interp *Interpreter) Lint(source string, file string, config LintConfig) error {
+	defer interp.flush()
+	interp.index(source, file, &linter{interp, config})
+	if interp.had_error {
+		return StaticError{"linting"}
+	}
+	return nil
+}
+
+// linter reports warnings while the resolver walks a program, and checks
+// the finished SymbolIndex. All methods can be called on a nil linter.
+type linter struct {
+	interp *Interpreter
+	config LintConfig
+}
+
+func (ln *linter) warn(rule lint_rule, span Span, message string) {
+	if ln == nil || !ln.config.enabled(rule) {
+		return
+	}
+	ln.interp.add(Diagnostic{SeverityWarning, rule.code, message, ln.interp.file, span})
+}
+
+// unreachable warns about the statements following a return, throw,
+// break or continue.
+func (ln *linter) unreachable(stmts []Stmt) {
+	if ln == nil {
+		return
+	}
+	var rest []Stmt
+	for i, stmt := range stmts {
+		switch stmt.(type) {
+		case Return, Throw, Break, Continue:
+			rest = stmts[i+1:]
+		}
+		if rest != nil {
+			break
+		}
+	}
+	var first, last Stmt
+	for _, stmt := range rest {
+		if stmt != nil {
+			if first == nil {
+				first = stmt
+			}
+			last = stmt
+		}
+	}
+	if first != nil {
+		ln.warn(rule_unreachable_code, Span{first.span().start, last.span().end}, "Unreachable code")
+	}
+}
+
+// condition warns about the condition of an if or a loop when it is
+// made of literals only. Loops written as while (true) or for (;;) are
+// meant to run until they break.
+func (ln *linter) condition(condition Expr, loop bool) {
+	if ln == nil {
+		return
+	}
+	if literal, ok := condition.(*Literal); ok && loop && literal.value == true {
+		return
+	}
+	value, ok := fold(condition)
+	if !ok {
+		return
+	}
+	ln.warn(rule_constant_condition, condition.span(), fmt.Sprintf("Condition is always %t", is_truthy(value)))
+}
+
+// fold computes the value of an expression that only combines literals,
+// without running the program. It reports false for any other expression,
+// and for one that would fail, such as -"a".
+func fold(expr Expr) (Value, bool) {
+	switch t := expr.(type) {
+	case *Literal:
+		return t.value, true
+	case *Grouping:
+		return fold(t.expression)
+	case *Unary:
+		right, ok := fold(t.right)
+		if !ok {
+			return nil, false
+		}
+		value, err := unary_op(t.operator, right)
+		return value, err == nil
+	case *Binary:
+		left, ok := fold(t.left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := fold(t.right)
+		if !ok {
+			return nil, false
+		}
+		value, err := binary_op(t.operator, left, right)
+		return value, err == nil
+	case *Logical:
+		left, ok := fold(t.left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := fold(t.right)
+		if !ok {
+			return nil, false
+		}
+		if t.operator.t_type == OR && is_truthy(left) || t.operator.t_type == AND && !is_truthy(left) {
+			return left, true
+		}
+		return right, true
+	}
+	return nil, false
+}
+
+// finish runs the rules that need the whole index, then drops the
+// warnings that lint comments turn off.
+func (ln *linter) finish(index *SymbolIndex, comments []Comment) {
+	if ln == nil {
+		return
+	}
+	for _, symbol := range index.symbols {
+		if symbol.global || symbol.kind == MethodSymbol {
+			continue
+		}
+		name := symbol.name.lexeme
+		if symbol.reads == 0 && !strings.HasPrefix(name, "_") {
+			what := "Local variable"
+			switch symbol.kind {
+			case ParameterSymbol:
+				what = "Parameter"
+			case FunctionSymbol:
+				what = "Local function"
+			case ClassSymbol:
+				what = "Local class"
+			}
+			ln.warn(rule_unused_variable, symbol.name.span, fmt.Sprintf("%s '%s' is never used", what, name))
+		}
+		shadowed := symbol.shadows
+		if shadowed == nil {
+			shadowed = index.globals[name]
+		}
+		if shadowed != nil {
+			message := fmt.Sprintf("'%s' shadows the declaration on line %d", name, shadowed.name.line)
+			ln.warn(rule_shadowing, symbol.name.span, message)
+		}
+	}
+	for _, ref := range index.global_refs {
+		if _, declared := index.globals[ref.name.lexeme]; ref.write && !declared && !index.is_builtin(ref.name.lexeme) {
+			ln.warn(rule_undeclared_global, ref.name.span, fmt.Sprintf("Assignment to undeclared global '%s'", ref.name.lexeme))
+		}
+	}
+	ln.suppress(comments)
+	sort.SliceStable(ln.interp.diagnostics, func(i, j int) bool {
+		a, b := ln.interp.diagnostics[i].Span.start, ln.interp.diagnostics[j].Span.start
+		return a.line < b.line || (a.line == b.line && a.column < b.column)
+	})
+}
+
+// lint_directive is a comment such as
+//
+//	// lint:disable shadowing, unused-variable
+//
+// Its verb is disable or enable, which hold until the end of the file or
+// the next directive, or disable-line or disable-next-line. Without rule
+// names it applies to every rule.
+type lint_directive struct {
+	verb  string
+	rules []string
+	line  int
+}
+
+func (ld lint_directive) covers(rule lint_rule) bool {
+	if len(ld.rules) == 0 {
+		return true
+	}
+	for _, name := range ld.rules {
+		if name == rule.name || name == rule.code {
+			return true
+		}
+	}
+	return false
+}
+
+func parse_directive(comment Comment) (lint_directive, bool) {
+	text := strings.TrimSpace(strings.TrimPrefix(comment.text, "//"))
+	text, found := strings.CutPrefix(text, "lint:")
+	if !found {
+		return lint_directive{}, false
+	}
+	fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+	if len(fields) == 0 {
+		return lint_directive{}, false
+	}
+	return lint_directive{fields[0], fields[1:], comment.span.start.line}, true
+}
+
+// suppress removes the warnings turned off by lint comments.
+func (ln *linter) suppress(comments []Comment) {
+	var directives []lint_directive
+	for _, comment := range comments {
+		if directive, ok := parse_directive(comment); ok {
+			directives = append(directives, directive)
+		}
+	}
+	if len(directives) == 0 {
+		return
+	}
+	kept := ln.interp.diagnostics[:0]
+	for _, diagnostic := range ln.interp.diagnostics {
+		rule, ok := find_rule(diagnostic.Code)
+		if !ok || diagnostic.Severity != SeverityWarning || !suppressed(directives, rule, diagnostic.Span.start.line) {
+			kept = append(kept, diagnostic)
+		}
+	}
+	ln.interp.diagnostics = kept
+}
+
+func suppressed(directives []lint_directive, rule lint_rule, line int) bool {
+	disabled := false
+	for _, directive := range directives {
+		if !directive.covers(rule) {
+			continue
+		}
+		switch directive.verb {
+		case "disable":
+			if directive.line <= line {
+				disabled = true
+			}
+		case "enable":
+			if directive.line <= line {
+				disabled = false
+			}
+		case "disable-line":
+			if directive.line == line {
+				return true
+			}
+		case "disable-next-line":
+			if directive.line+1 == line {
+				return true
+			}
+		}
+	}
+	return disabled
+}
+
+// lint_document indexes a document for the language server, with the
+// warnings of the lint config found for file.
+func lint_document(source string, file string) *SymbolIndex {
+	interp := NewInterpreter(WithStderr(io.Discard))
+	config, err := FindLintConfig(file)
+	if err != nil {
+		config = LintConfig{}
+	}
+	index, _ := interp.index(source, file, &linter{interp, config})
+	return index
+}
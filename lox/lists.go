@@ -0,0 +1,144 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Type representing Lox lists. Lists are shared by reference, so they are
+// always handled through a pointer.
+type LoxList struct {
+	elements []Value
+}
+
+func (ll *LoxList) get(name Token) (Value, error) {
+	switch name.lexeme {
+	case "push":
+		return native_method{"push", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+			if err := interp.allocate(&interp.memory.Collections, element_size); err != nil {
+				return nil, err
+			}
+			ll.elements = append(ll.elements, arguments[0])
+			return nil, nil
+		}}, nil
+	case "pop":
+		return Native{"pop", 0, func(arguments []Value) (Value, error) {
+			if len(ll.elements) == 0 {
+				return nil, errors.New("Can't pop from an empty list.")
+			}
+			last := ll.elements[len(ll.elements)-1]
+			ll.elements = ll.elements[:len(ll.elements)-1]
+			return last, nil
+		}}, nil
+	case "len":
+		return Native{"len", 0, func(arguments []Value) (Value, error) {
+			return float64(len(ll.elements)), nil
+		}}, nil
+	case "slice":
+		return native_method{"slice", 2, func(interp *Interpreter, arguments []Value) (Value, error) {
+			start, err := list_bound(arguments[0], len(ll.elements))
+			if err != nil {
+				return nil, err
+			}
+			end, err := list_bound(arguments[1], len(ll.elements))
+			if err != nil {
+				return nil, err
+			}
+			if start > end {
+				return nil, errors.New("Slice start must not be after its end.")
+			}
+			if err := interp.allocate(&interp.memory.Collections, list_size+element_size*(end-start)); err != nil {
+				return nil, err
+			}
+			elements := make([]Value, end-start)
+			copy(elements, ll.elements[start:end])
+			return &LoxList{elements}, nil
+		}}, nil
+	case "insert":
+		return native_method{"insert", 2, func(interp *Interpreter, arguments []Value) (Value, error) {
+			i, err := list_bound(arguments[0], len(ll.elements))
+			if err != nil {
+				return nil, err
+			}
+			if err := interp.allocate(&interp.memory.Collections, element_size); err != nil {
+				return nil, err
+			}
+			ll.elements = append(ll.elements, nil)
+			copy(ll.elements[i+1:], ll.elements[i:])
+			ll.elements[i] = arguments[1]
+			return nil, nil
+		}}, nil
+	case "remove":
+		return Native{"remove", 1, func(arguments []Value) (Value, error) {
+			i, err := list_bound(arguments[0], len(ll.elements)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed := ll.elements[i]
+			ll.elements = append(ll.elements[:i], ll.elements[i+1:]...)
+			return removed, nil
+		}}, nil
+	}
+	return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+}
+
+// position checks that index can be used to subscript the list and
+// converts it to an int.
+func (ll *LoxList) position(bracket Token, index Value) (int, error) {
+	f, ok := index.(float64)
+	if !ok || f != math.Trunc(f) {
+		return 0, RuntimeError{"List index must be an integer.", bracket}
+	}
+	if f < 0 || f >= float64(len(ll.elements)) {
+		msg := fmt.Sprintf("List index %s out of range for list of length %d.", stringify(f), len(ll.elements))
+		return 0, RuntimeError{msg, bracket}
+	}
+	return int(f), nil
+}
+
+func (ll *LoxList) String() string {
+	return stringify_nested(ll, make(map[Value]bool))
+}
+
+// list_bound converts a method argument into a position between 0 and
+// limit inclusive.
+func list_bound(arg Value, limit int) (int, error) {
+	f, ok := arg.(float64)
+	if !ok || f != math.Trunc(f) {
+		return 0, errors.New("List position must be an integer.")
+	}
+	if f < 0 || f > float64(limit) {
+		return 0, fmt.Errorf("List position %s out of range.", stringify(f))
+	}
+	return int(f), nil
+}
+
+// stringify_nested prints value as an element of a container, quoting
+// strings and cutting off containers that contain themselves.
+func stringify_nested(value Value, seen map[Value]bool) string {
+	switch t := value.(type) {
+	case string:
+		return "\"" + t + "\""
+	case *LoxList:
+		if seen[t] {
+			return "[...]"
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		parts := make([]string, len(t.elements))
+		for i, element := range t.elements {
+			parts[i] = stringify_nested(element, seen)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *LoxMap:
+		if seen[t] {
+			return "{...}"
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		return stringify_map(t, seen)
+	}
+	return stringify(value)
+}
@@ -0,0 +1,105 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// StaticError is returned by Run when the source could not be parsed or
+// resolved. The individual errors have already been reported.
+type StaticError struct {
+	phase string
+}
+
+func (se StaticError) Error() string {
+	return "Error occurred while " + se.phase
+}
+
+// Run scans, parses, resolves and interprets source. Global definitions
+// persist between calls, so Run can be used to drive a REPL.
+func (interp *Interpreter) Run(source string) error {
+	return interp.run(context.Background(), source, "")
+}
+
+// RunContext is Run, stopping with a LimitError once ctx is done.
+func (interp *Interpreter) RunContext(ctx context.Context, source string) error {
+	return interp.run(ctx, source, "")
+}
+
+// Incomplete reports whether source ends inside a string or with brackets
+// left open, so that a REPL should read another line before running it.
+func Incomplete(source string) bool {
+	rp := &reporter{out: io.Discard}
+	rp.begin(source, "")
+	tokens := NewLexer(source, rp).scan_tokens()
+	for _, diagnostic := range rp.diagnostics {
+		if diagnostic.Code == code_unterminated_string {
+			return true
+		}
+	}
+	depth := 0
+	for _, token := range tokens {
+		switch token.t_type {
+		case LEFT_PAREN, LEFT_BRACE, LEFT_BRACKET:
+			depth++
+		case RIGHT_PAREN, RIGHT_BRACE, RIGHT_BRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// run is RunContext for source read from file, which may be empty.
+func (interp *Interpreter) run(ctx context.Context, source string, file string) error {
+	stmts, err := interp.analyze(source, file)
+	if err != nil {
+		return err
+	}
+	interp.run_error = false
+	cancel := interp.start_limits(ctx)
+	defer cancel()
+	if interp.backend == Bytecode {
+		function := interp.compile(stmts, file)
+		interp.flush()
+		if interp.had_error {
+			return StaticError{"compiling"}
+		}
+		return interp.run_bytecode(function)
+	}
+	return interp.interpret(stmts, file)
+}
+
+// analyze scans, parses and resolves source, writing out the diagnostics
+// found along the way.
+func (interp *Interpreter) analyze(source string, file string) ([]Stmt, error) {
+	interp.begin(source, file)
+	defer interp.flush()
+	lscanner := NewLexer(source, interp.reporter)
+	tokens := lscanner.scan_tokens()
+	parser := Parser{tokens: tokens, reporter: interp.reporter, file: file}
+	stmts, err := parser.parse()
+	if err != nil {
+		return nil, err
+	}
+	if interp.had_error {
+		return nil, StaticError{"parsing"}
+	}
+	interp.resolve(stmts)
+	if interp.had_error {
+		return nil, StaticError{"resolving"}
+	}
+	return stmts, nil
+}
+
+// runtime_error reports an error that escaped the script, followed by the
+// stack trace captured when it was raised.
+func (interp *Interpreter) runtime_error(re RuntimeError) {
+	fmt.Fprintln(interp.reporter.out, re.message)
+	if interp.trace == nil {
+		fmt.Fprintf(interp.reporter.out, "[line %d]\n", re.token.line)
+	}
+	write_trace(interp.reporter.out, interp.trace)
+	interp.trace = nil
+	interp.run_error = true
+}
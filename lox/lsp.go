@@ -0,0 +1,482 @@
+package lox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSON-RPC error codes used by the language server.
+const (
+	lsp_parse_error      = -32700
+	lsp_method_not_found = -32601
+)
+
+// Kinds from the LSP specification for document symbols and completions.
+var lsp_symbol_kinds = map[SymbolKind]int{
+	VariableSymbol:  13,
+	ParameterSymbol: 13,
+	FunctionSymbol:  12,
+	ClassSymbol:     5,
+	MethodSymbol:    6,
+	ModuleSymbol:    2,
+}
+
+var lsp_completion_kinds = map[SymbolKind]int{
+	VariableSymbol:  6,
+	ParameterSymbol: 6,
+	FunctionSymbol:  3,
+	ClassSymbol:     7,
+	MethodSymbol:    2,
+	ModuleSymbol:    9,
+}
+
+const (
+	lsp_keyword_completion  = 14
+	lsp_constant_completion = 21
+)
+
+type lsp_request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lsp_error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lsp_position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lsp_range struct {
+	Start lsp_position `json:"start"`
+	End   lsp_position `json:"end"`
+}
+
+type lsp_location struct {
+	URI   string    `json:"uri"`
+	Range lsp_range `json:"range"`
+}
+
+type lsp_document_id struct {
+	URI string `json:"uri"`
+}
+
+type lsp_position_params struct {
+	TextDocument lsp_document_id `json:"textDocument"`
+	Position     lsp_position    `json:"position"`
+	Context      struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+type lsp_diagnostic struct {
+	Range    lsp_range `json:"range"`
+	Severity int       `json:"severity"`
+	Code     string    `json:"code"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+type lsp_document_symbol struct {
+	Name           string                `json:"name"`
+	Detail         string                `json:"detail,omitempty"`
+	Kind           int                   `json:"kind"`
+	Range          lsp_range             `json:"range"`
+	SelectionRange lsp_range             `json:"selectionRange"`
+	Children       []lsp_document_symbol `json:"children,omitempty"`
+}
+
+type lsp_completion struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lsp_hover struct {
+	Contents struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"contents"`
+	Range lsp_range `json:"range"`
+}
+
+// lsp_document is an open document and the index of its last version.
+type lsp_document struct {
+	uri   string
+	text  string
+	lines []int
+	index *SymbolIndex
+}
+
+func new_document(uri string, text string) *lsp_document {
+	doc := &lsp_document{uri: uri, text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lines = append(doc.lines, i+1)
+		}
+	}
+	doc.index = lint_document(text, uri_path(uri))
+	return doc
+}
+
+// position converts a position in the source to an LSP position, whose
+// character is counted in UTF-16 code units.
+func (doc *lsp_document) position(pos Position) lsp_position {
+	line := min(max(pos.line-1, 0), len(doc.lines)-1)
+	if pos.column == 0 {
+		return lsp_position{line, 0}
+	}
+	start := doc.lines[line]
+	offset := min(max(pos.offset, start), len(doc.text))
+	return lsp_position{line, utf16_length(doc.text[start:offset])}
+}
+
+func (doc *lsp_document) span_range(span Span) lsp_range {
+	return lsp_range{doc.position(span.start), doc.position(span.end)}
+}
+
+// offset converts an LSP position to a byte offset in the source.
+func (doc *lsp_document) offset(pos lsp_position) int {
+	if pos.Line >= len(doc.lines) {
+		return len(doc.text)
+	}
+	offset := doc.lines[max(pos.Line, 0)]
+	for units := 0; units < pos.Character && offset < len(doc.text); {
+		rn, size := utf8.DecodeRuneInString(doc.text[offset:])
+		if rn == '\n' {
+			break
+		}
+		units += utf16_units(rn)
+		offset += size
+	}
+	return offset
+}
+
+func (doc *lsp_document) location(span Span) lsp_location {
+	return lsp_location{doc.uri, doc.span_range(span)}
+}
+
+// utf16_units returns how many UTF-16 code units encode rn.
+func utf16_units(rn rune) int {
+	if rn >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func utf16_length(text string) int {
+	length := 0
+	for _, rn := range text {
+		length += utf16_units(rn)
+	}
+	return length
+}
+
+// uri_path returns the file path of a file URI, for diagnostics.
+func uri_path(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return parsed.Path
+}
+
+// lsp_server answers the requests of one editor session.
+type lsp_server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*lsp_document
+}
+
+// ServeLSP runs a language server speaking the Language Server Protocol
+// on in and out until the client asks it to exit. Documents are analyzed
+// with the lexer, parser and resolver, and are never run.
+func ServeLSP(in io.Reader, out io.Writer) error {
+	server := &lsp_server{in: bufio.NewReader(in), out: out, documents: make(map[string]*lsp_document)}
+	for {
+		body, err := read_message(server.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var request lsp_request
+		if err := json.Unmarshal(body, &request); err != nil {
+			server.respond(nil, nil, &lsp_error{lsp_parse_error, err.Error()})
+			continue
+		}
+		if request.Method == "exit" {
+			return nil
+		}
+		result, rpc_err := server.handle(request)
+		if request.ID != nil {
+			server.respond(request.ID, result, rpc_err)
+		}
+	}
+}
+
+// read_message returns the body of the next message on in, framed by a
+// Content-Length header. The debug adapter frames its messages the same
+// way.
+func read_message(in *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %v", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(in, body)
+	return body, err
+}
+
+func (server *lsp_server) write(message map[string]any) {
+	message["jsonrpc"] = "2.0"
+	write_message(server.out, message)
+}
+
+func write_message(out io.Writer, message map[string]any) {
+	body, _ := json.Marshal(message)
+	fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (server *lsp_server) respond(id json.RawMessage, result any, rpc_err *lsp_error) {
+	message := map[string]any{"id": id}
+	if id == nil {
+		message["id"] = nil
+	}
+	if rpc_err != nil {
+		message["error"] = rpc_err
+	} else {
+		message["result"] = result
+	}
+	server.write(message)
+}
+
+func (server *lsp_server) notify(method string, params any) {
+	server.write(map[string]any{"method": method, "params": params})
+}
+
+func (server *lsp_server) handle(request lsp_request) (any, *lsp_error) {
+	switch request.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "glox"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(request.Params, &params) == nil {
+			server.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+		return nil, nil
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lsp_document_id `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(request.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			server.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lsp_document_id `json:"textDocument"`
+		}
+		if json.Unmarshal(request.Params, &params) == nil {
+			delete(server.documents, params.TextDocument.URI)
+			server.notify("textDocument/publishDiagnostics", map[string]any{
+				"uri":         params.TextDocument.URI,
+				"diagnostics": []lsp_diagnostic{},
+			})
+		}
+		return nil, nil
+	case "textDocument/definition":
+		return server.with_position(request, definition)
+	case "textDocument/references":
+		return server.with_position(request, references)
+	case "textDocument/hover":
+		return server.with_position(request, hover)
+	case "textDocument/completion":
+		return server.with_position(request, completion)
+	case "textDocument/documentSymbol":
+		var params struct {
+			TextDocument lsp_document_id `json:"textDocument"`
+		}
+		json.Unmarshal(request.Params, &params)
+		doc, ok := server.documents[params.TextDocument.URI]
+		if !ok {
+			return []lsp_document_symbol{}, nil
+		}
+		return document_symbols(doc, doc.index.outline), nil
+	}
+	if request.ID == nil {
+		// Notifications the server does not support are ignored.
+		return nil, nil
+	}
+	return nil, &lsp_error{lsp_method_not_found, "Unsupported method '" + request.Method + "'"}
+}
+
+// update analyzes the new text of a document and publishes its
+// diagnostics.
+func (server *lsp_server) update(uri string, text string) {
+	doc := new_document(uri, text)
+	server.documents[uri] = doc
+	diagnostics := []lsp_diagnostic{}
+	for _, diagnostic := range doc.index.diagnostics {
+		span := doc.span_range(diagnostic.Span)
+		if diagnostic.Span.start.column == 0 {
+			// Line-only diagnostics cover their whole line.
+			span.End = lsp_position{span.Start.Line + 1, 0}
+		}
+		severity := 1
+		if diagnostic.Severity == SeverityWarning {
+			severity = 2
+		}
+		diagnostics = append(diagnostics, lsp_diagnostic{span, severity, diagnostic.Code, "glox", diagnostic.Message})
+	}
+	server.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+// with_position decodes the document and position of a request and passes
+// them to answer. Requests for unknown documents get a null result.
+func (server *lsp_server) with_position(request lsp_request, answer func(*lsp_document, int, lsp_position_params) any) (any, *lsp_error) {
+	var params lsp_position_params
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return nil, &lsp_error{lsp_parse_error, err.Error()}
+	}
+	doc, ok := server.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return answer(doc, doc.offset(params.Position), params), nil
+}
+
+func definition(doc *lsp_document, offset int, params lsp_position_params) any {
+	symbol, _, ok := doc.index.symbol_at(offset)
+	if !ok {
+		return nil
+	}
+	return doc.location(symbol.name.span)
+}
+
+func references(doc *lsp_document, offset int, params lsp_position_params) any {
+	locations := []lsp_location{}
+	symbol, _, ok := doc.index.symbol_at(offset)
+	if !ok {
+		return locations
+	}
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, doc.location(symbol.name.span))
+	}
+	for _, span := range symbol.references {
+		locations = append(locations, doc.location(span))
+	}
+	return locations
+}
+
+// describe_builtin returns the hover text and completion kind of the
+// builtin name, which is a constant when it can't be called.
+func describe_builtin(index *SymbolIndex, name string) (string, int) {
+	if index.constants[name] {
+		return "constant " + name, lsp_constant_completion
+	}
+	return "native function " + name, lsp_completion_kinds[FunctionSymbol]
+}
+
+func hover(doc *lsp_document, offset int, params lsp_position_params) any {
+	var text string
+	var span Span
+	if symbol, at, ok := doc.index.symbol_at(offset); ok {
+		text, span = symbol.describe(), at
+	} else if name, ok := doc.index.builtin_at(offset); ok {
+		text, _ = describe_builtin(doc.index, name.lexeme)
+		span = name.span
+	} else {
+		return nil
+	}
+	var result lsp_hover
+	result.Contents.Kind = "markdown"
+	result.Contents.Value = "```lox\n" + text + "\n```"
+	result.Range = doc.span_range(span)
+	return result
+}
+
+func completion(doc *lsp_document, offset int, params lsp_position_params) any {
+	items := []lsp_completion{}
+	for _, symbol := range doc.index.visible_at(offset) {
+		items = append(items, lsp_completion{symbol.name.lexeme, lsp_completion_kinds[symbol.kind], symbol.describe()})
+	}
+	for _, name := range doc.index.builtins {
+		if _, declared := doc.index.globals[name]; !declared {
+			detail, kind := describe_builtin(doc.index, name)
+			items = append(items, lsp_completion{name, kind, detail})
+		}
+	}
+	var words []string
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	for _, word := range words {
+		items = append(items, lsp_completion{word, lsp_keyword_completion, ""})
+	}
+	return items
+}
+
+func document_symbols(doc *lsp_document, symbols []*Symbol) []lsp_document_symbol {
+	result := []lsp_document_symbol{}
+	for _, symbol := range symbols {
+		result = append(result, lsp_document_symbol{
+			Name:           symbol.name.lexeme,
+			Detail:         strings.TrimSpace(symbol.detail),
+			Kind:           lsp_symbol_kinds[symbol.kind],
+			Range:          doc.span_range(symbol.loc),
+			SelectionRange: doc.span_range(symbol.name.span),
+			Children:       document_symbols(doc, symbol.children),
+		})
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package lox
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Type representing Lox maps. Entries are kept in insertion order so that
+// iterating over a map is deterministic.
+type LoxMap struct {
+	entries []MapEntry
+	index   map[Value]int
+}
+
+type MapEntry struct {
+	key   Value
+	value Value
+}
+
+func new_lox_map() *LoxMap {
+	return &LoxMap{index: make(map[Value]int)}
+}
+
+func (lm *LoxMap) lookup(key Value) (Value, bool) {
+	if i, ok := lm.index[key]; ok {
+		return lm.entries[i].value, true
+	}
+	return nil, false
+}
+
+func (lm *LoxMap) store(key Value, value Value) {
+	if i, ok := lm.index[key]; ok {
+		lm.entries[i].value = value
+		return
+	}
+	lm.index[key] = len(lm.entries)
+	lm.entries = append(lm.entries, MapEntry{key, value})
+}
+
+func (lm *LoxMap) remove(key Value) bool {
+	i, ok := lm.index[key]
+	if !ok {
+		return false
+	}
+	delete(lm.index, key)
+	lm.entries = append(lm.entries[:i], lm.entries[i+1:]...)
+	for j := i; j < len(lm.entries); j++ {
+		lm.index[lm.entries[j].key] = j
+	}
+	return true
+}
+
+func (lm *LoxMap) get(name Token) (Value, error) {
+	switch name.lexeme {
+	case "keys":
+		return native_method{"keys", 0, func(interp *Interpreter, arguments []Value) (Value, error) {
+			if err := interp.allocate(&interp.memory.Collections, list_size+element_size*len(lm.entries)); err != nil {
+				return nil, err
+			}
+			keys := make([]Value, len(lm.entries))
+			for i, entry := range lm.entries {
+				keys[i] = entry.key
+			}
+			return &LoxList{keys}, nil
+		}}, nil
+	case "values":
+		return native_method{"values", 0, func(interp *Interpreter, arguments []Value) (Value, error) {
+			if err := interp.allocate(&interp.memory.Collections, list_size+element_size*len(lm.entries)); err != nil {
+				return nil, err
+			}
+			values := make([]Value, len(lm.entries))
+			for i, entry := range lm.entries {
+				values[i] = entry.value
+			}
+			return &LoxList{values}, nil
+		}}, nil
+	case "has":
+		return Native{"has", 1, func(arguments []Value) (Value, error) {
+			if !valid_key(arguments[0]) {
+				return false, nil
+			}
+			_, ok := lm.lookup(arguments[0])
+			return ok, nil
+		}}, nil
+	case "delete":
+		return Native{"delete", 1, func(arguments []Value) (Value, error) {
+			if !valid_key(arguments[0]) {
+				return nil, errors.New(invalid_key_message)
+			}
+			return lm.remove(arguments[0]), nil
+		}}, nil
+	case "len":
+		return Native{"len", 0, func(arguments []Value) (Value, error) {
+			return float64(len(lm.entries)), nil
+		}}, nil
+	}
+	return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+}
+
+func (lm *LoxMap) String() string {
+	return stringify_nested(lm, make(map[Value]bool))
+}
+
+const invalid_key_message = "Map keys must be strings, numbers, booleans or nil."
+
+// valid_key reports whether key can be used in a map. Only values whose
+// equality under is_equal matches Go's == are allowed.
+func valid_key(key Value) bool {
+	switch key.(type) {
+	case nil, bool, float64, string:
+		return true
+	}
+	return false
+}
+
+func check_key(bracket Token, key Value) error {
+	if !valid_key(key) {
+		return RuntimeError{invalid_key_message, bracket}
+	}
+	return nil
+}
+
+func stringify_map(lm *LoxMap, seen map[Value]bool) string {
+	parts := make([]string, len(lm.entries))
+	for i, entry := range lm.entries {
+		parts[i] = stringify_nested(entry.key, seen) + ": " + stringify_nested(entry.value, seen)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// sort_keys orders map keys converted from Go, whose iteration order is
+// random: nil, then booleans, then numbers, then strings.
+func sort_keys(keys []Value) {
+	rank := func(key Value) int {
+		switch key.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		switch ki := keys[i].(type) {
+		case bool:
+			return !ki && keys[j].(bool)
+		case float64:
+			return ki < keys[j].(float64)
+		case string:
+			return ki < keys[j].(string)
+		}
+		return false
+	})
+}
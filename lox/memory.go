@@ -0,0 +1,89 @@
+package lox
+
+import "errors"
+
+// The sizes, in bytes, charged for each kind of allocation. They are
+// estimates of what the Go values behind the Lox objects take, headers
+// and map buckets included, not exact measurements.
+const (
+	string_size      = 16
+	instance_size    = 64
+	field_size       = 32
+	environment_size = 64
+	variable_size    = 32
+	closure_size     = 48
+	upvalue_size     = 16
+	list_size        = 24
+	element_size     = 16
+	map_size         = 64
+	entry_size       = 48
+)
+
+var err_memory_limit = errors.New("Memory limit exceeded.")
+
+// MemoryStats estimates the bytes a run has allocated, by kind of object.
+// The counts only grow: memory the garbage collector reclaims is not given
+// back, so a loop that keeps allocating runs into the limit.
+type MemoryStats struct {
+	Strings      int64
+	Instances    int64
+	Environments int64
+	Closures     int64
+	Collections  int64
+}
+
+// Total returns the bytes allocated by all kinds of objects.
+func (ms MemoryStats) Total() int64 {
+	return ms.Strings + ms.Instances + ms.Environments + ms.Closures + ms.Collections
+}
+
+// MemoryStats returns the allocations of the last run, or of the run in
+// progress when called from a native.
+func (interp *Interpreter) MemoryStats() MemoryStats {
+	return interp.memory
+}
+
+// out_of_memory reports whether the run has allocated more than
+// Limits.MaxMemory. The error raised then cannot be caught by the script.
+func (interp *Interpreter) out_of_memory() bool {
+	return interp.limits.MaxMemory > 0 && interp.memory.Total() > interp.limits.MaxMemory
+}
+
+// allocate charges bytes to the counter kind, which points into
+// interp.memory. Once the total passes Limits.MaxMemory it returns an
+// error, and keeps doing so for every later allocation of the run.
+func (interp *Interpreter) allocate(kind *int64, bytes int) error {
+	*kind += int64(bytes)
+	if interp.out_of_memory() {
+		return err_memory_limit
+	}
+	return nil
+}
+
+// allocate_at is allocate for allocations made by the code at token,
+// raising a runtime error there when the limit is exceeded.
+func (interp *Interpreter) allocate_at(token Token, kind *int64, bytes int) error {
+	if err := interp.allocate(kind, bytes); err != nil {
+		return RuntimeError{err.Error(), token}
+	}
+	return nil
+}
+
+// allocate_store charges storing a value into object under key, when that
+// adds a field to an instance or an entry to a map.
+func (interp *Interpreter) allocate_store(object Value, key Value, token Token) error {
+	switch container := object.(type) {
+	case LoxInstance:
+		if _, ok := container.fields[key.(string)]; !ok {
+			return interp.allocate_at(token, &interp.memory.Instances, field_size+len(key.(string)))
+		}
+	case *LoxMap:
+		if check_key(token, key) != nil {
+			return nil
+		}
+		if _, ok := container.index[key]; !ok {
+			return interp.allocate_at(token, &interp.memory.Collections, entry_size)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Module is the namespace created by importing a file. Its members are the
+// top-level bindings of that file.
+type Module struct {
+	name    string
+	globals *Environment
+}
+
+func (md *Module) get(name Token) (Value, error) {
+	if value, ok := md.globals.values[name.lexeme]; ok {
+		return value, nil
+	}
+	return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+}
+
+func (md *Module) String() string {
+	return "<module " + md.name + ">"
+}
+
+// RunFile runs the script at path. Imports in the script are resolved
+// relative to its directory.
+func (interp *Interpreter) RunFile(path string) error {
+	return interp.RunFileContext(context.Background(), path)
+}
+
+// RunFileContext is RunFile, stopping with a LimitError once ctx is done.
+func (interp *Interpreter) RunFileContext(ctx context.Context, path string) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		interp.loading = append(interp.loading, abs)
+		defer func() { interp.loading = interp.loading[:len(interp.loading)-1] }()
+	}
+	return interp.run(ctx, string(bytes), path)
+}
+
+// import_module returns the module for the file at path, loading it the
+// first time it is imported. Relative paths are looked up next to the
+// importing file and then in each directory listed in GLOX_PATH.
+func (interp *Interpreter) import_module(keyword Token, path string, from string) (*Module, error) {
+	file, ok := find_module(path, from)
+	if !ok {
+		return nil, RuntimeError{"Could not find module '" + path + "'.", keyword}
+	}
+	if module, ok := interp.modules[file]; ok {
+		return module, nil
+	}
+	for i, loading := range interp.loading {
+		if loading == file {
+			var chain []string
+			for _, link := range append(interp.loading[i:len(interp.loading):len(interp.loading)], file) {
+				chain = append(chain, filepath.Base(link))
+			}
+			return nil, RuntimeError{"Import cycle: " + strings.Join(chain, " -> ") + ".", keyword}
+		}
+	}
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, RuntimeError{fmt.Sprintf("Could not read module '%s': %v.", path, err), keyword}
+	}
+	interp.loading = append(interp.loading, file)
+	defer func() { interp.loading = interp.loading[:len(interp.loading)-1] }()
+	module := &Module{path, &Environment{interp.builtins, make(map[string]Value)}}
+	if err := interp.run_module(module, string(bytes), file); err != nil {
+		if static, ok := err.(StaticError); ok {
+			return nil, RuntimeError{fmt.Sprintf("%s module '%s'.", static.Error(), path), keyword}
+		}
+		return nil, err
+	}
+	interp.modules[file] = module
+	return module, nil
+}
+
+// run_module runs source as the body of module, with the module's
+// environment as the globals.
+func (interp *Interpreter) run_module(module *Module, source string, file string) error {
+	had_error, in_repl := interp.had_error, interp.in_repl
+	enclosing := interp.globals
+	interp.globals, interp.in_repl = module.globals, false
+	defer func() {
+		interp.globals, interp.in_repl = enclosing, in_repl
+		interp.had_error = had_error
+	}()
+	stmts, err := interp.analyze(source, file)
+	if err != nil {
+		return err
+	}
+	if interp.backend == Bytecode {
+		function := interp.compile(stmts, file)
+		interp.flush()
+		if interp.had_error {
+			return StaticError{"compiling"}
+		}
+		closure := &Closure{function, nil, module.globals}
+		_, err := interp.get_vm().invoke(closure, closure, nil)
+		return err
+	}
+	interp.push_frame("<script>", file)
+	defer interp.pop_frame()
+	for _, stmt := range stmts {
+		if err := interp.execute(stmt, module.globals); err != nil {
+			interp.capture_trace(interp.frames, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func find_module(path string, from string) (string, bool) {
+	var candidates []string
+	if filepath.IsAbs(path) {
+		candidates = append(candidates, path)
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(from), path))
+		for _, dir := range filepath.SplitList(os.Getenv("GLOX_PATH")) {
+			if dir != "" {
+				candidates = append(candidates, filepath.Join(dir, path))
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			if abs, err := filepath.Abs(candidate); err == nil {
+				return abs, true
+			}
+			return candidate, true
+		}
+	}
+	return "", false
+}
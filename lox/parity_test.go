@@ -0,0 +1,35 @@
+package lox
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// run_corpus_file runs path on backend, returning what it wrote to stdout
+// and stderr.
+func run_corpus_file(path string, backend Backend) (string, string) {
+	var stdout, stderr bytes.Buffer
+	interp := NewInterpreter(WithBackend(backend), WithStdout(&stdout), WithStderr(&stderr))
+	interp.RunFile(path)
+	return stdout.String(), stderr.String()
+}
+
+// TestBackendParity runs every script in testdata on both backends, which
+// must print the same output and report the same errors.
+func TestBackendParity(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.lox"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no scripts in testdata: %v", err)
+	}
+	for _, path := range paths {
+		tree_out, tree_err := run_corpus_file(path, TreeWalk)
+		vm_out, vm_err := run_corpus_file(path, Bytecode)
+		if tree_out != vm_out {
+			t.Errorf("%s: stdout differs\ntree:\n%s\nvm:\n%s", path, tree_out, vm_out)
+		}
+		if tree_err != vm_err {
+			t.Errorf("%s: stderr differs\ntree:\n%s\nvm:\n%s", path, tree_err, vm_err)
+		}
+	}
+}
@@ -1,14 +1,15 @@
-package main
+package lox
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 )
 
 type Parser struct {
-	tokens  []Token
-	current int
+	tokens   []Token
+	current  int
+	reporter *reporter
+	file     string
 }
 
 type ParseError struct {
@@ -37,8 +38,10 @@ func (ps *Parser) declaration() Stmt {
 		}
 		return stmt
 	}
-	if ps.match(FUN) {
-		stmt, err := ps.function("function")
+	// A function without a name is a lambda in an expression statement.
+	if ps.check(FUN) && ps.tokens[ps.current+1].t_type != LEFT_PAREN {
+		keyword := ps.advance()
+		stmt, err := ps.function("function", keyword)
 		if err != nil {
 			ps.synchronize()
 			return nil
@@ -53,6 +56,14 @@ func (ps *Parser) declaration() Stmt {
 		}
 		return stmt
 	}
+	if ps.match(IMPORT) {
+		stmt, err := ps.import_declaration()
+		if err != nil {
+			ps.synchronize()
+			return nil
+		}
+		return stmt
+	}
 	stmt, err := ps.statement()
 	if err != nil {
 		ps.synchronize()
@@ -61,7 +72,34 @@ func (ps *Parser) declaration() Stmt {
 	return stmt
 }
 
+// span_from returns the span from start to the last token consumed.
+func (ps *Parser) span_from(start Token) Span {
+	return start.span.to(ps.previous().span)
+}
+
+func (ps *Parser) import_declaration() (Stmt, error) {
+	keyword := ps.previous()
+	path, err := ps.consume(STRING, "Expect module path after 'import'")
+	if err != nil {
+		return nil, err
+	}
+	if !ps.check(IDENTIFIER) || ps.peek().lexeme != "as" {
+		return nil, ps.error(ps.peek(), code_syntax, "Expect 'as' after module path")
+	}
+	ps.advance()
+	name, err := ps.consume(IDENTIFIER, "Expect module name after 'as'")
+	if err != nil {
+		return nil, err
+	}
+	_, err = ps.consume(SEMICOLON, "Expect ';' after import")
+	if err != nil {
+		return nil, err
+	}
+	return Import{keyword, path.literal.(string), name, ps.file, ps.span_from(keyword)}, nil
+}
+
 func (ps *Parser) var_declaration() (Stmt, error) {
+	keyword := ps.previous()
 	name, err := ps.consume(IDENTIFIER, "Expect variable name")
 	if err != nil {
 		return nil, err
@@ -75,21 +113,22 @@ func (ps *Parser) var_declaration() (Stmt, error) {
 		initializer = val
 	}
 	ps.consume(SEMICOLON, "Expect ';' after variable declaration")
-	return Var{name, initializer}, nil
+	return Var{name, initializer, ps.span_from(keyword)}, nil
 }
 
 func (ps *Parser) class_declaration() (Stmt, error) {
+	keyword := ps.previous()
 	name, err := ps.consume(IDENTIFIER, "Expect class name")
 	if err != nil {
 		return nil, err
 	}
-	var superclass Variable
+	var superclass *Variable
 	if ps.match(LESS) {
 		_, err = ps.consume(IDENTIFIER, "Expect superclass name")
 		if err != nil {
 			return nil, err
 		}
-		superclass = Variable{ps.previous()}
+		superclass = &Variable{ps.previous()}
 	}
 	_, err = ps.consume(LEFT_BRACE, "Expect '{' before class body")
 	if err != nil {
@@ -97,7 +136,7 @@ func (ps *Parser) class_declaration() (Stmt, error) {
 	}
 	var methods []Func
 	for !ps.check(RIGHT_BRACE) && !ps.finished() {
-		md, err := ps.function("method")
+		md, err := ps.function("method", ps.peek())
 		if err != nil {
 			return nil, err
 		}
@@ -107,10 +146,12 @@ func (ps *Parser) class_declaration() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Class{name, superclass, methods}, nil
+	return Class{name, superclass, methods, ps.span_from(keyword)}, nil
 }
 
-func (ps *Parser) function(kind string) (Func, error) {
+// function parses a named function or method. Its span begins at start,
+// which is the fun keyword for functions and the name for methods.
+func (ps *Parser) function(kind string, start Token) (Func, error) {
 	var new_function Func
 	name, err := ps.consume(IDENTIFIER, "Expect "+kind+" name")
 	if err != nil {
@@ -120,11 +161,18 @@ func (ps *Parser) function(kind string) (Func, error) {
 	if err != nil {
 		return new_function, err
 	}
+	return ps.function_body(kind, name, start)
+}
+
+// function_body parses the parameters and body of a function, after the
+// opening parenthesis of its parameter list.
+func (ps *Parser) function_body(kind string, name Token, start Token) (Func, error) {
+	var new_function Func
 	var parameters []Token
 	if !ps.check(RIGHT_PAREN) {
 		for {
 			if len(parameters) >= 255 {
-				ps.error(ps.peek(), "Cannot have more than 255 parameters")
+				ps.error(ps.peek(), code_too_many_arguments, "Cannot have more than 255 parameters")
 			}
 			param, err := ps.consume(IDENTIFIER, "Expect parameter name")
 			if err != nil {
@@ -136,7 +184,7 @@ func (ps *Parser) function(kind string) (Func, error) {
 			}
 		}
 	}
-	_, err = ps.consume(RIGHT_PAREN, "Expect ')' after parameters")
+	_, err := ps.consume(RIGHT_PAREN, "Expect ')' after parameters")
 	if err != nil {
 		return new_function, err
 	}
@@ -151,10 +199,15 @@ func (ps *Parser) function(kind string) (Func, error) {
 	new_function.name = name
 	new_function.params = parameters
 	new_function.body = body
+	new_function.loc = ps.span_from(start)
+	new_function.file = ps.file
 	return new_function, nil
 }
 
 func (ps *Parser) statement() (Stmt, error) {
+	if ps.match(BREAK, CONTINUE) {
+		return ps.loop_jump_statement()
+	}
 	if ps.match(FOR) {
 		return ps.for_statement()
 	}
@@ -167,15 +220,22 @@ func (ps *Parser) statement() (Stmt, error) {
 	if ps.match(RETURN) {
 		return ps.return_statement()
 	}
+	if ps.match(THROW) {
+		return ps.throw_statement()
+	}
+	if ps.match(TRY) {
+		return ps.try_statement()
+	}
 	if ps.match(WHILE) {
 		return ps.while_statement()
 	}
 	if ps.match(LEFT_BRACE) {
+		brace := ps.previous()
 		stmts, err := ps.block()
 		if err != nil {
 			return nil, err
 		}
-		return Block{stmts}, nil
+		return Block{stmts, ps.span_from(brace)}, nil
 	}
 	return ps.expression_statement()
 }
@@ -194,6 +254,7 @@ func (ps *Parser) block() ([]Stmt, error) {
 }
 
 func (ps *Parser) print_statement() (Stmt, error) {
+	keyword := ps.previous()
 	value, err := ps.expression()
 	if err != nil {
 		return nil, err
@@ -202,10 +263,11 @@ func (ps *Parser) print_statement() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Print{value}, nil
+	return Print{value, ps.span_from(keyword)}, nil
 }
 
 func (ps *Parser) expression_statement() (Stmt, error) {
+	start := ps.peek()
 	expr, err := ps.expression()
 	if err != nil {
 		return nil, err
@@ -214,10 +276,11 @@ func (ps *Parser) expression_statement() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Expression{expr}, nil
+	return Expression{expr, ps.span_from(start)}, nil
 }
 
 func (ps *Parser) if_statement() (Stmt, error) {
+	keyword := ps.previous()
 	_, err := ps.consume(LEFT_PAREN, "Expect  '(' after if")
 	if err != nil {
 		return nil, err
@@ -241,7 +304,7 @@ func (ps *Parser) if_statement() (Stmt, error) {
 			return nil, err
 		}
 	}
-	return If{cond, then_branch, else_branch}, nil
+	return If{cond, then_branch, else_branch, ps.span_from(keyword)}, nil
 }
 
 func (ps *Parser) return_statement() (Stmt, error) {
@@ -255,10 +318,89 @@ func (ps *Parser) return_statement() (Stmt, error) {
 		}
 	}
 	_, err = ps.consume(SEMICOLON, "Expect semicolon after return value")
-	return Return{keyword, value}, nil
+	return Return{keyword, value, ps.span_from(keyword)}, nil
+}
+
+func (ps *Parser) throw_statement() (Stmt, error) {
+	keyword := ps.previous()
+	value, err := ps.expression()
+	if err != nil {
+		return nil, err
+	}
+	_, err = ps.consume(SEMICOLON, "Expect ';' after thrown value")
+	if err != nil {
+		return nil, err
+	}
+	return Throw{keyword, value, ps.span_from(keyword)}, nil
+}
+
+func (ps *Parser) try_statement() (Stmt, error) {
+	keyword := ps.previous()
+	brace, err := ps.consume(LEFT_BRACE, "Expect '{' after 'try'")
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := ps.block()
+	if err != nil {
+		return nil, err
+	}
+	body := Block{stmts, ps.span_from(brace)}
+	var catch *Catch
+	if ps.match(CATCH) {
+		_, err = ps.consume(LEFT_PAREN, "Expect '(' after 'catch'")
+		if err != nil {
+			return nil, err
+		}
+		name, err := ps.consume(IDENTIFIER, "Expect error variable name")
+		if err != nil {
+			return nil, err
+		}
+		_, err = ps.consume(RIGHT_PAREN, "Expect ')' after error variable")
+		if err != nil {
+			return nil, err
+		}
+		brace, err := ps.consume(LEFT_BRACE, "Expect '{' after catch clause")
+		if err != nil {
+			return nil, err
+		}
+		catch_body, err := ps.block()
+		if err != nil {
+			return nil, err
+		}
+		catch = &Catch{name, catch_body, ps.span_from(brace)}
+	}
+	var finally *Block
+	if ps.match(FINALLY) {
+		brace, err := ps.consume(LEFT_BRACE, "Expect '{' after 'finally'")
+		if err != nil {
+			return nil, err
+		}
+		finally_body, err := ps.block()
+		if err != nil {
+			return nil, err
+		}
+		finally = &Block{finally_body, ps.span_from(brace)}
+	}
+	if catch == nil && finally == nil {
+		return nil, ps.error(ps.peek(), code_syntax, "Expect 'catch' or 'finally' after try block")
+	}
+	return Try{body, catch, finally, ps.span_from(keyword)}, nil
+}
+
+func (ps *Parser) loop_jump_statement() (Stmt, error) {
+	keyword := ps.previous()
+	_, err := ps.consume(SEMICOLON, "Expect ';' after '"+keyword.lexeme+"'")
+	if err != nil {
+		return nil, err
+	}
+	if keyword.t_type == BREAK {
+		return Break{keyword, ps.span_from(keyword)}, nil
+	}
+	return Continue{keyword, ps.span_from(keyword)}, nil
 }
 
 func (ps *Parser) while_statement() (Stmt, error) {
+	keyword := ps.previous()
 	_, err := ps.consume(LEFT_PAREN, "Expect '(' after 'while'")
 	if err != nil {
 		return nil, err
@@ -275,10 +417,11 @@ func (ps *Parser) while_statement() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return While{expr, body}, nil
+	return While{expr, body, nil, ps.span_from(keyword)}, nil
 }
 
 func (ps *Parser) for_statement() (Stmt, error) {
+	keyword := ps.previous()
 	_, err := ps.consume(LEFT_PAREN, "Expect '(' after 'for'")
 	if err != nil {
 		return nil, err
@@ -295,7 +438,7 @@ func (ps *Parser) for_statement() (Stmt, error) {
 		return nil, err
 	}
 	var condition Expr = nil
-	if !ps.match(SEMICOLON) {
+	if !ps.check(SEMICOLON) {
 		condition, err = ps.expression()
 		if err != nil {
 			return nil, err
@@ -320,17 +463,14 @@ func (ps *Parser) for_statement() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	if increment != nil {
-		stmts := []Stmt{body, Expression{increment}}
-		body = Block{stmts}
-	}
+	loc := ps.span_from(keyword)
 	if condition == nil {
-		condition = Literal{true}
+		condition = &Literal{true, keyword.span}
 	}
-	body = While{condition, body}
+	body = While{condition, body, increment, loc}
 	if initializer != nil {
 		stmts := []Stmt{initializer, body}
-		body = Block{stmts}
+		body = Block{stmts, loc}
 	}
 	return body, nil
 }
@@ -350,14 +490,17 @@ func (ps *Parser) assignment() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		if assignee, ok := expr.(Variable); ok {
+		if assignee, ok := expr.(*Variable); ok {
 			name := assignee.name
-			return Assign{name, value}, nil
+			return &Assign{name, value}, nil
+		}
+		if get, ok := expr.(*Get); ok {
+			return &Set{get.object, get.name, value}, nil
 		}
-		if get, ok := expr.(Get); ok {
-			return Set{get.object, get.name, value}, nil
+		if index, ok := expr.(*Index); ok {
+			return &SetIndex{index.object, index.bracket, index.index, value}, nil
 		}
-		ps.error(equals, "Invalid assignment target")
+		ps.error(equals, code_invalid_assignment, "Invalid assignment target")
 	}
 	return expr, nil
 }
@@ -373,7 +516,7 @@ func (ps *Parser) or() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Logical{expr, op, right}
+		expr = &Logical{expr, op, right}
 	}
 	return expr, nil
 }
@@ -389,7 +532,7 @@ func (ps *Parser) and() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Logical{expr, op, right}
+		expr = &Logical{expr, op, right}
 	}
 	return expr, nil
 }
@@ -406,7 +549,7 @@ func (ps *Parser) equality() (Expr, error) {
 			return nil, err
 		}
 		//fmt.Println("Matched binary in equality")
-		expr = Binary{expr, op, right}
+		expr = &Binary{expr, op, right}
 	}
 	return expr, nil
 }
@@ -422,7 +565,7 @@ func (ps *Parser) comparison() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Binary{expr, op, right}
+		expr = &Binary{expr, op, right}
 	}
 	return expr, nil
 }
@@ -439,7 +582,7 @@ func (ps *Parser) term() (Expr, error) {
 			return nil, err
 		}
 		//fmt.Println("Matched binary in term")
-		expr = Binary{expr, op, right}
+		expr = &Binary{expr, op, right}
 	}
 
 	return expr, nil
@@ -457,7 +600,7 @@ func (ps *Parser) factor() (Expr, error) {
 			return nil, err
 		}
 		//fmt.Println("Matched binary in factor")
-		expr = Binary{expr, op, right}
+		expr = &Binary{expr, op, right}
 	}
 
 	return expr, nil
@@ -471,7 +614,7 @@ func (ps *Parser) unary() (Expr, error) {
 			return nil, err
 		}
 		//fmt.Println("Matched unary")
-		return Unary{op, right}, nil
+		return &Unary{op, right}, nil
 	}
 	return ps.call()
 }
@@ -492,7 +635,17 @@ func (ps *Parser) call() (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			expr = Get{expr, name}
+			expr = &Get{expr, name}
+		} else if ps.match(LEFT_BRACKET) {
+			index, err := ps.expression()
+			if err != nil {
+				return nil, err
+			}
+			bracket, err := ps.consume(RIGHT_BRACKET, "Expect ']' after index")
+			if err != nil {
+				return nil, err
+			}
+			expr = &Index{expr, bracket, index}
 		} else {
 			break
 		}
@@ -509,7 +662,7 @@ func (ps *Parser) finish_call(callee Expr) (Expr, error) {
 				return nil, err
 			}
 			if len(args) >= 255 {
-				ps.error(ps.peek(), "Cannot have more than 255 arguments to a function")
+				ps.error(ps.peek(), code_too_many_arguments, "Cannot have more than 255 arguments to a function")
 			}
 			args = append(args, expr)
 			if !ps.match(COMMA) {
@@ -521,24 +674,24 @@ func (ps *Parser) finish_call(callee Expr) (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Call{callee, paren, args}, nil
+	return &Call{callee, paren, args}, nil
 }
 
 func (ps *Parser) primary() (Expr, error) {
 	if ps.match(FALSE) {
-		return Literal{false}, nil
+		return &Literal{false, ps.previous().span}, nil
 	}
 	if ps.match(TRUE) {
-		return Literal{true}, nil
+		return &Literal{true, ps.previous().span}, nil
 	}
 	if ps.match(NIL) {
-		return Literal{value: nil}, nil
+		return &Literal{nil, ps.previous().span}, nil
 	}
 	if ps.match(IDENTIFIER) {
-		return Variable{ps.previous()}, nil
+		return &Variable{ps.previous()}, nil
 	}
 	if ps.match(THIS) {
-		return This{ps.previous()}, nil
+		return &This{ps.previous()}, nil
 	}
 	if ps.match(SUPER) {
 		keyword := ps.previous()
@@ -550,13 +703,28 @@ func (ps *Parser) primary() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return Super{keyword, method}, nil
+		return &Super{keyword, method}, nil
 	}
 	if ps.match(NUMBER, STRING) {
-		return Literal{ps.previous().literal}, nil
+		return &Literal{ps.previous().literal, ps.previous().span}, nil
+	}
+
+	if ps.match(LEFT_BRACKET) {
+		return ps.list()
+	}
+	if ps.match(LEFT_BRACE) {
+		return ps.map_literal()
+	}
+
+	if ps.match(FUN) {
+		return ps.lambda()
+	}
+	if ps.check(LEFT_PAREN) && ps.arrow_ahead() {
+		return ps.arrow_function()
 	}
 
 	if ps.match(LEFT_PAREN) {
+		paren := ps.previous()
 		//fmt.Println("Matched a left paren")
 		expr, err := ps.expression()
 		if err != nil {
@@ -566,10 +734,120 @@ func (ps *Parser) primary() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return Grouping{expr}, nil
+		return &Grouping{expr, ps.span_from(paren)}, nil
 	}
 	//fmt.Println("Matched a left paren")
-	return nil, errors.New("Expect expression")
+	return nil, ps.error(ps.peek(), code_syntax, "Expect expression")
+}
+
+// Lambdas are named "anonymous", which is how they print.
+func (ps *Parser) lambda() (Expr, error) {
+	keyword := ps.previous()
+	name := Token{IDENTIFIER, "anonymous", nil, keyword.line, keyword.span}
+	_, err := ps.consume(LEFT_PAREN, "Expect '(' after 'fun'")
+	if err != nil {
+		return nil, err
+	}
+	function, err := ps.function_body("function", name, keyword)
+	if err != nil {
+		return nil, err
+	}
+	return &Lambda{function}, nil
+}
+
+// arrow_ahead reports whether the parenthesis at the current token opens
+// the parameter list of an arrow function.
+func (ps *Parser) arrow_ahead() bool {
+	i := ps.current + 1
+	if ps.tokens[i].t_type == IDENTIFIER {
+		i++
+		// Parameters are separated by commas, with none after the last,
+		// as in the parameter list of fun.
+		for ps.tokens[i].t_type == COMMA && ps.tokens[i+1].t_type == IDENTIFIER {
+			i += 2
+		}
+	}
+	return ps.tokens[i].t_type == RIGHT_PAREN && ps.tokens[i+1].t_type == ARROW
+}
+
+// arrow_function parses (params) => expr, or (params) => { body }.
+func (ps *Parser) arrow_function() (Expr, error) {
+	paren := ps.advance()
+	name := Token{IDENTIFIER, "anonymous", nil, paren.line, paren.span}
+	var parameters []Token
+	for !ps.check(RIGHT_PAREN) {
+		parameters = append(parameters, ps.advance())
+		ps.match(COMMA)
+	}
+	if len(parameters) > 255 {
+		ps.error(ps.peek(), code_too_many_arguments, "Cannot have more than 255 parameters")
+	}
+	ps.advance()
+	arrow := ps.advance()
+	var body []Stmt
+	if ps.match(LEFT_BRACE) {
+		stmts, err := ps.block()
+		if err != nil {
+			return nil, err
+		}
+		body = stmts
+	} else {
+		value, err := ps.expression()
+		if err != nil {
+			return nil, err
+		}
+		body = []Stmt{Return{arrow, value, value.span()}}
+	}
+	return &Lambda{Func{name, parameters, body, ps.span_from(paren), ps.file}}, nil
+}
+
+func (ps *Parser) list() (Expr, error) {
+	bracket := ps.previous()
+	var elements []Expr
+	for !ps.check(RIGHT_BRACKET) {
+		expr, err := ps.expression()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, expr)
+		if !ps.match(COMMA) {
+			break
+		}
+	}
+	_, err := ps.consume(RIGHT_BRACKET, "Expect ']' after list elements")
+	if err != nil {
+		return nil, err
+	}
+	return &List{bracket, elements, ps.span_from(bracket)}, nil
+}
+
+func (ps *Parser) map_literal() (Expr, error) {
+	brace := ps.previous()
+	var keys, values []Expr
+	for !ps.check(RIGHT_BRACE) {
+		key, err := ps.expression()
+		if err != nil {
+			return nil, err
+		}
+		_, err = ps.consume(COLON, "Expect ':' after map key")
+		if err != nil {
+			return nil, err
+		}
+		value, err := ps.expression()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+		if !ps.match(COMMA) {
+			break
+		}
+	}
+	_, err := ps.consume(RIGHT_BRACE, "Expect '}' after map entries")
+	if err != nil {
+		return nil, err
+	}
+	return &Map{brace, keys, values, ps.span_from(brace)}, nil
 }
 
 func (ps *Parser) match(t_types ...TokenType) bool {
@@ -601,12 +879,19 @@ func (ps *Parser) consume(t_type TokenType, message string) (Token, error) {
 		return ps.advance(), nil
 	}
 
-	return Token{}, ps.error(ps.peek(), message)
+	// A missing token at the end of a line is reported right after the
+	// previous token rather than at the start of the next line.
+	if ps.current > 0 && ps.peek().line > ps.previous().line {
+		end := ps.previous().span.end
+		ps.reporter.error_at(Span{end, end}, code_syntax, message)
+		return Token{}, ParseError{message}
+	}
+	return Token{}, ps.error(ps.peek(), code_syntax, message)
 }
 
-func (ps Parser) error(token Token, message string) error {
-	token_error(token, message)
-	return errors.New("")
+func (ps Parser) error(token Token, code string, message string) error {
+	ps.reporter.token_error(token, code, message)
+	return ParseError{message}
 }
 
 func (ps *Parser) synchronize() {
@@ -623,6 +908,8 @@ func (ps *Parser) synchronize() {
 			fallthrough
 		case VAR:
 			fallthrough
+		case IMPORT:
+			fallthrough
 		case FOR:
 			fallthrough
 		case IF:
@@ -632,6 +919,14 @@ func (ps *Parser) synchronize() {
 		case PRINT:
 			fallthrough
 		case RETURN:
+			fallthrough
+		case THROW:
+			fallthrough
+		case TRY:
+			fallthrough
+		case BREAK:
+			fallthrough
+		case CONTINUE:
 			return
 		}
 		ps.advance()
@@ -653,17 +948,17 @@ func (ps Parser) previous() Token {
 func print(expr Expr) string {
 	var ast string
 	switch t := expr.(type) {
-	case Binary:
+	case *Binary:
 		ast = parenthesize(t.operator.lexeme, t.left, t.right)
-	case Grouping:
+	case *Grouping:
 		ast = parenthesize("group", t.expression)
-	case Literal:
+	case *Literal:
 		if t.value == nil {
 			ast = "nil"
 		} else {
 			ast = fmt.Sprintf("%v", t.value)
 		}
-	case Unary:
+	case *Unary:
 		ast = parenthesize(t.operator.lexeme, t.right)
 	}
 	return ast
@@ -0,0 +1,355 @@
+package lox
+
+import (
+	"fmt"
+	"os"
+)
+
+type FunctionType int
+
+const (
+	NONE FunctionType = iota
+	FUNCTION
+	METHOD
+	INITIALIZER
+)
+
+type ClassType int
+
+const (
+	NOCLASS ClassType = iota
+	NORMALCLASS
+	SUBCLASS
+)
+
+type Stack []map[string]bool
+
+func (st Stack) empty() bool {
+	return len(st) == 0
+}
+
+func (st Stack) peek() (map[string]bool, bool) {
+	if st.empty() {
+		return nil, false
+	}
+	return st[len(st)-1], true
+}
+
+func (st *Stack) pop() (map[string]bool, bool) {
+	if st.empty() {
+		return nil, false
+	}
+	entry, _ := st.peek()
+	(*st) = (*st)[:len(*st)-1]
+	return entry, true
+}
+
+func (st *Stack) push(entry map[string]bool) {
+	(*st) = append((*st), entry)
+}
+
+// Resolver performs the static pass that binds every local variable
+// reference to a scope depth, recording the result in its interpreter.
+type Resolver struct {
+	interp        *Interpreter
+	init_scopes   *Stack
+	curr_function FunctionType
+	curr_class    ClassType
+	loop_depth    int
+	// index, when set, records every declaration and reference for the
+	// language server and the linter, and lint checks for warnings.
+	index *SymbolIndex
+	lint  *linter
+}
+
+func (interp *Interpreter) resolve(statements []Stmt) {
+	rs := Resolver{interp: interp, init_scopes: new(Stack), curr_function: NONE, curr_class: NOCLASS}
+	rs.resolve_stmts(statements, rs.init_scopes)
+}
+
+func (rs *Resolver) resolve_stmts(statements []Stmt, scopes *Stack) {
+	rs.lint.unreachable(statements)
+	for _, stmt := range statements {
+		// Declarations that failed to parse are left in as nil, and are
+		// only resolved when indexing a document with errors.
+		if stmt != nil {
+			rs.resolve_stmt(stmt, scopes)
+		}
+	}
+}
+
+func (rs *Resolver) resolve_stmt(stmt Stmt, scopes *Stack) {
+	switch t := stmt.(type) {
+	case Block:
+		rs.begin_scope(scopes, t.loc)
+		rs.resolve_stmts(t.statements, scopes)
+		rs.end_scope(scopes)
+		return
+	case Class:
+		enclosing_class := rs.curr_class
+		rs.curr_class = NORMALCLASS
+		rs.declare(t.name, scopes)
+		rs.define(t.name, scopes)
+		class := rs.index.declare(t.name, ClassSymbol, t.loc, superclass_detail(t))
+		if t.superclass != nil && t.superclass.name.lexeme == t.name.lexeme {
+			rs.interp.token_error(t.name, code_inherit_self, "A class cannot inherit from itself")
+		}
+		if t.superclass != nil {
+			rs.curr_class = SUBCLASS
+			rs.resolve_expr(t.superclass, scopes)
+		}
+		if t.superclass != nil {
+			rs.begin_scope(scopes, t.loc)
+			scope, _ := scopes.peek()
+			scope["super"] = true
+		}
+		rs.begin_scope(scopes, t.loc)
+		scope, _ := scopes.peek()
+		scope["this"] = true
+		rs.index.enter(class)
+		for _, method := range t.methods {
+			declaration := METHOD
+			if method.name.lexeme == "init" {
+				declaration = INITIALIZER
+			}
+			rs.index.enter(rs.index.method(method))
+			rs.resolve_func(method, scopes, declaration)
+			rs.index.leave()
+		}
+		rs.index.leave()
+		rs.end_scope(scopes)
+		if t.superclass != nil {
+			rs.end_scope(scopes)
+		}
+		rs.curr_class = enclosing_class
+		return
+	case Expression:
+		rs.resolve_expr(t.expr, scopes)
+		return
+	case Func:
+		rs.declare(t.name, scopes)
+		rs.define(t.name, scopes)
+		function := rs.index.declare(t.name, FunctionSymbol, t.loc, parameter_list(t.params))
+		rs.index.enter(function)
+		rs.resolve_func(t, scopes, FUNCTION)
+		rs.index.leave()
+		return
+	case If:
+		rs.lint.condition(t.condition, false)
+		rs.resolve_expr(t.condition, scopes)
+		rs.resolve_stmt(t.then_branch, scopes)
+		if t.else_branch != nil {
+			rs.resolve_stmt(t.else_branch, scopes)
+		}
+		return
+	case Print:
+		rs.resolve_expr(t.expr, scopes)
+		return
+	case Break:
+		if rs.loop_depth == 0 {
+			rs.interp.token_error(t.keyword, code_jump_outside_loop, "Can't use 'break' outside of a loop")
+		}
+		return
+	case Continue:
+		if rs.loop_depth == 0 {
+			rs.interp.token_error(t.keyword, code_jump_outside_loop, "Can't use 'continue' outside of a loop")
+		}
+		return
+	case Return:
+		if rs.curr_function == NONE {
+			rs.interp.token_error(t.keyword, code_top_level_return, "Can't return from top level routine")
+		}
+		if t.value != nil {
+			if rs.curr_function == INITIALIZER {
+				rs.interp.token_error(t.keyword, code_initializer_return, "Can't return a value from an initializer")
+				rs.lint.warn(rule_init_return, t.loc, "'init' always returns 'this', not the value returned")
+			}
+			rs.resolve_expr(t.value, scopes)
+		}
+		return
+	case Throw:
+		rs.resolve_expr(t.value, scopes)
+		return
+	case Try:
+		rs.resolve_stmt(t.body, scopes)
+		if t.catch != nil {
+			rs.begin_scope(scopes, Span{t.catch.name.span.start, t.loc.end})
+			rs.declare(t.catch.name, scopes)
+			rs.define(t.catch.name, scopes)
+			rs.index.declare(t.catch.name, VariableSymbol, t.catch.name.span, "")
+			rs.resolve_stmts(t.catch.body, scopes)
+			rs.end_scope(scopes)
+		}
+		if t.finally != nil {
+			rs.resolve_stmt(*t.finally, scopes)
+		}
+		return
+	case Import:
+		rs.declare(t.name, scopes)
+		rs.define(t.name, scopes)
+		rs.index.declare(t.name, ModuleSymbol, t.loc, fmt.Sprintf(" %q", t.path))
+		return
+	case Var:
+		rs.declare(t.name, scopes)
+		if t.initializer != nil {
+			rs.resolve_expr(t.initializer, scopes)
+		}
+		rs.define(t.name, scopes)
+		rs.index.declare(t.name, VariableSymbol, t.loc, "")
+		return
+	case While:
+		rs.lint.condition(t.condition, true)
+		rs.resolve_expr(t.condition, scopes)
+		rs.loop_depth++
+		rs.resolve_stmt(t.body, scopes)
+		rs.loop_depth--
+		if t.increment != nil {
+			rs.resolve_expr(t.increment, scopes)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Internal error, encountered unkown statement type: %v", stmt)
+	panic(69)
+}
+
+func (rs *Resolver) resolve_expr(expr Expr, scopes *Stack) {
+	switch t := expr.(type) {
+	case *Assign:
+		rs.resolve_expr(t.value, scopes)
+		rs.resolve_local(t, t.name, scopes)
+		return
+	case *Binary:
+		rs.resolve_expr(t.left, scopes)
+		rs.resolve_expr(t.right, scopes)
+		return
+	case *Call:
+		rs.resolve_expr(t.callee, scopes)
+		for _, arg := range t.arguments {
+			rs.resolve_expr(arg, scopes)
+		}
+		return
+	case *Get:
+		rs.resolve_expr(t.object, scopes)
+		return
+	case *Grouping:
+		rs.resolve_expr(t.expression, scopes)
+		return
+	case *Index:
+		rs.resolve_expr(t.object, scopes)
+		rs.resolve_expr(t.index, scopes)
+		return
+	case *Lambda:
+		rs.resolve_func(t.function, scopes, FUNCTION)
+		return
+	case *List:
+		for _, element := range t.elements {
+			rs.resolve_expr(element, scopes)
+		}
+		return
+	case *Map:
+		for i := range t.keys {
+			rs.resolve_expr(t.keys[i], scopes)
+			rs.resolve_expr(t.values[i], scopes)
+		}
+		return
+	case *Literal:
+		return
+	case *Logical:
+		rs.resolve_expr(t.left, scopes)
+		rs.resolve_expr(t.right, scopes)
+		return
+	case *Set:
+		rs.resolve_expr(t.value, scopes)
+		rs.resolve_expr(t.object, scopes)
+		return
+	case *SetIndex:
+		rs.resolve_expr(t.value, scopes)
+		rs.resolve_expr(t.object, scopes)
+		rs.resolve_expr(t.index, scopes)
+		return
+	case *Super:
+		if rs.curr_class == NOCLASS {
+			rs.interp.token_error(t.keyword, code_invalid_super, "Can't use 'super' outside of a class")
+		} else if rs.curr_class == NORMALCLASS {
+			rs.interp.token_error(t.keyword, code_invalid_super, "Can't use 'super' in a class with no superclasses")
+		}
+		rs.resolve_local(t, t.keyword, scopes)
+		return
+	case *This:
+		if rs.curr_class == NOCLASS {
+			rs.interp.token_error(t.keyword, code_this_outside_class, "Can't use 'this' outside of a class")
+			return
+		}
+		rs.resolve_local(t, t.keyword, scopes)
+		return
+	case *Unary:
+		rs.resolve_expr(t.right, scopes)
+		return
+	case *Variable:
+		if scope, ok := scopes.peek(); ok {
+			if resolved, ok := scope[t.name.lexeme]; ok && !resolved {
+				rs.interp.token_error(t.name, code_own_initializer, "Can't read local variable in its own initializer")
+			}
+		}
+		rs.resolve_local(t, t.name, scopes)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Internal error, encountered unkown expression type: %v", expr)
+	panic(69)
+}
+
+func (rs *Resolver) resolve_func(function Func, scopes *Stack, f_type FunctionType) {
+	enclosing_function, enclosing_loops := rs.curr_function, rs.loop_depth
+	rs.curr_function, rs.loop_depth = f_type, 0
+	rs.begin_scope(scopes, function.loc)
+	for _, param := range function.params {
+		rs.declare(param, scopes)
+		rs.define(param, scopes)
+		rs.index.declare(param, ParameterSymbol, param.span, "")
+	}
+	rs.resolve_stmts(function.body, scopes)
+	rs.end_scope(scopes)
+	rs.curr_function, rs.loop_depth = enclosing_function, enclosing_loops
+}
+
+func (rs *Resolver) resolve_local(expr Expr, name Token, scopes *Stack) {
+	_, write := expr.(*Assign)
+	for i := len(*scopes) - 1; i > -1; i-- {
+		if _, ok := (*scopes)[i][name.lexeme]; ok {
+			rs.interp.set_scope(expr, len(*scopes)-i-1)
+			rs.index.reference(name, len(*scopes)-i-1, write)
+			return
+		}
+	}
+	rs.index.reference(name, -1, write)
+}
+
+func (rs *Resolver) declare(name Token, scopes *Stack) {
+	if scopes.empty() {
+		return
+	}
+	scope, _ := scopes.peek()
+	if _, ok := scope[name.lexeme]; ok {
+		rs.interp.token_error(name, code_duplicate_variable, "Already a variable with this name in this scope")
+	}
+	scope[name.lexeme] = false
+}
+
+func (rs *Resolver) define(name Token, scopes *Stack) {
+	if scopes.empty() {
+		return
+	}
+	scope, _ := scopes.peek()
+	scope[name.lexeme] = true
+}
+
+// begin_scope opens a scope for the code covered by span.
+func (rs *Resolver) begin_scope(scopes *Stack, span Span) {
+	scopes.push(make(map[string]bool))
+	rs.index.open(span)
+}
+
+func (rs *Resolver) end_scope(scopes *Stack) {
+	scopes.pop()
+	rs.index.close()
+}
@@ -0,0 +1,204 @@
+package lox
+
+type Stmt interface {
+	saccept()
+	span() Span
+}
+
+type Block struct {
+	statements []Stmt
+	loc        Span
+}
+
+func (bl Block) saccept() {
+}
+
+func (bl Block) span() Span {
+	return bl.loc
+}
+
+type Expression struct {
+	expr Expr
+	loc  Span
+}
+
+func (ex Expression) saccept() {
+}
+
+func (ex Expression) span() Span {
+	return ex.loc
+}
+
+type Print struct {
+	expr Expr
+	loc  Span
+}
+
+func (pr Print) saccept() {
+}
+
+func (pr Print) span() Span {
+	return pr.loc
+}
+
+type Var struct {
+	name        Token
+	initializer Expr
+	loc         Span
+}
+
+func (vr Var) saccept() {
+}
+
+func (vr Var) span() Span {
+	return vr.loc
+}
+
+type If struct {
+	condition   Expr
+	then_branch Stmt
+	else_branch Stmt
+	loc         Span
+}
+
+func (iff If) saccept() {
+}
+
+func (iff If) span() Span {
+	return iff.loc
+}
+
+// While is a loop. Loops desugared from for keep their increment apart
+// from the body so that continue still runs it.
+type While struct {
+	condition Expr
+	body      Stmt
+	increment Expr
+	loc       Span
+}
+
+func (wh While) saccept() {
+}
+
+func (wh While) span() Span {
+	return wh.loc
+}
+
+// Import binds the module loaded from path to name. file is the importing
+// file, which relative paths are resolved against.
+type Import struct {
+	keyword Token
+	path    string
+	name    Token
+	file    string
+	loc     Span
+}
+
+func (im Import) saccept() {
+}
+
+func (im Import) span() Span {
+	return im.loc
+}
+
+type Func struct {
+	name   Token
+	params []Token
+	body   []Stmt
+	loc    Span
+	file   string
+}
+
+func (fc Func) saccept() {
+}
+
+func (fc Func) span() Span {
+	return fc.loc
+}
+
+type Break struct {
+	keyword Token
+	loc     Span
+}
+
+func (br Break) saccept() {
+}
+
+func (br Break) span() Span {
+	return br.loc
+}
+
+type Continue struct {
+	keyword Token
+	loc     Span
+}
+
+func (cn Continue) saccept() {
+}
+
+func (cn Continue) span() Span {
+	return cn.loc
+}
+
+type Throw struct {
+	keyword Token
+	value   Expr
+	loc     Span
+}
+
+func (th Throw) saccept() {
+}
+
+func (th Throw) span() Span {
+	return th.loc
+}
+
+// Try is a try statement. At least one of catch and finally is set.
+type Try struct {
+	body    Block
+	catch   *Catch
+	finally *Block
+	loc     Span
+}
+
+func (tr Try) saccept() {
+}
+
+func (tr Try) span() Span {
+	return tr.loc
+}
+
+// Catch is the catch clause of a try statement. Its span covers the braces
+// of its body.
+type Catch struct {
+	name Token
+	body []Stmt
+	loc  Span
+}
+
+type Return struct {
+	keyword Token
+	value   Expr
+	loc     Span
+}
+
+func (rn Return) saccept() {
+}
+
+func (rn Return) span() Span {
+	return rn.loc
+}
+
+type Class struct {
+	name       Token
+	superclass *Variable
+	methods    []Func
+	loc        Span
+}
+
+func (cl Class) saccept() {
+}
+
+func (cl Class) span() Span {
+	return cl.loc
+}
@@ -0,0 +1,205 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings are Go strings holding UTF-8. Their methods and indexing count
+// characters as Unicode code points, not bytes.
+
+// string_method returns the method called name bound to str.
+func string_method(str string, name Token) (Value, error) {
+	switch name.lexeme {
+	case "len":
+		return Native{"len", 0, func(arguments []Value) (Value, error) {
+			return float64(utf8.RuneCountInString(str)), nil
+		}}, nil
+	case "upper":
+		return string_result("upper", 0, func(arguments []Value) (int, func() string, error) {
+			return len(str), func() string { return strings.ToUpper(str) }, nil
+		}), nil
+	case "lower":
+		return string_result("lower", 0, func(arguments []Value) (int, func() string, error) {
+			return len(str), func() string { return strings.ToLower(str) }, nil
+		}), nil
+	case "trim":
+		return string_result("trim", 0, func(arguments []Value) (int, func() string, error) {
+			trimmed := strings.TrimSpace(str)
+			return len(trimmed), func() string { return trimmed }, nil
+		}), nil
+	case "split":
+		return native_method{"split", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+			sep, err := string_argument("split", arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			// Account for the parts before splitting: an empty separator
+			// splits str into its characters.
+			count, text := utf8.RuneCountInString(str), len(str)
+			if sep != "" {
+				count = strings.Count(str, sep) + 1
+				text -= (count - 1) * len(sep)
+			}
+			if err := interp.allocate(&interp.memory.Collections, list_size+count*(element_size+string_size)+text); err != nil {
+				return nil, err
+			}
+			parts := strings.Split(str, sep)
+			elements := make([]Value, len(parts))
+			for i, part := range parts {
+				elements[i] = part
+			}
+			return &LoxList{elements}, nil
+		}}, nil
+	case "contains":
+		return Native{"contains", 1, func(arguments []Value) (Value, error) {
+			sub, err := string_argument("contains", arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			return strings.Contains(str, sub), nil
+		}}, nil
+	case "indexOf":
+		return Native{"indexOf", 1, func(arguments []Value) (Value, error) {
+			sub, err := string_argument("indexOf", arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			i := strings.Index(str, sub)
+			if i < 0 {
+				return float64(-1), nil
+			}
+			return float64(utf8.RuneCountInString(str[:i])), nil
+		}}, nil
+	case "startsWith":
+		return Native{"startsWith", 1, func(arguments []Value) (Value, error) {
+			prefix, err := string_argument("startsWith", arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			return strings.HasPrefix(str, prefix), nil
+		}}, nil
+	case "endsWith":
+		return Native{"endsWith", 1, func(arguments []Value) (Value, error) {
+			suffix, err := string_argument("endsWith", arguments[0])
+			if err != nil {
+				return nil, err
+			}
+			return strings.HasSuffix(str, suffix), nil
+		}}, nil
+	case "replace":
+		return string_result("replace", 2, func(arguments []Value) (int, func() string, error) {
+			old, err := string_argument("replace", arguments[0])
+			if err != nil {
+				return 0, nil, err
+			}
+			replacement, err := string_argument("replace", arguments[1])
+			if err != nil {
+				return 0, nil, err
+			}
+			size := len(str) + strings.Count(str, old)*(len(replacement)-len(old))
+			return size, func() string { return strings.ReplaceAll(str, old, replacement) }, nil
+		}), nil
+	case "substring":
+		return string_result("substring", 2, func(arguments []Value) (int, func() string, error) {
+			runes := []rune(str)
+			start, err := string_bound(arguments[0], len(runes))
+			if err != nil {
+				return 0, nil, err
+			}
+			end, err := string_bound(arguments[1], len(runes))
+			if err != nil {
+				return 0, nil, err
+			}
+			if start > end {
+				return 0, nil, errors.New("Substring start must not be after its end.")
+			}
+			substring := string(runes[start:end])
+			return len(substring), func() string { return substring }, nil
+		}), nil
+	case "repeat":
+		return native_method{"repeat", 1, func(interp *Interpreter, arguments []Value) (Value, error) {
+			f, ok := arguments[0].(float64)
+			if !ok || f != math.Trunc(f) || f < 0 {
+				return nil, errors.New("Repeat count must be a non-negative integer.")
+			}
+			// Check the count before converting it, as a huge one would
+			// overflow, and account before building the string, so that a
+			// long result hits the memory limit instead of exhausting the
+			// host.
+			if f > math.MaxInt32 || f*float64(len(str)) > math.MaxInt32 {
+				return nil, errors.New("Repeated string is too long.")
+			}
+			if err := interp.allocate(&interp.memory.Strings, string_size+len(str)*int(f)); err != nil {
+				return nil, err
+			}
+			return strings.Repeat(str, int(f)), nil
+		}}, nil
+	}
+	return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+}
+
+// string_result wraps a method returning a new string. The method checks
+// its arguments and returns the length of the string and a function that
+// builds it, which is only called once that length is accounted for, so
+// that a long result hits the memory limit instead of exhausting the host.
+func string_result(name string, arity int, method func(arguments []Value) (int, func() string, error)) native_method {
+	return native_method{name, arity, func(interp *Interpreter, arguments []Value) (Value, error) {
+		size, build, err := method(arguments)
+		if err != nil {
+			return nil, err
+		}
+		if size > math.MaxInt32 {
+			return nil, fmt.Errorf("Result of '%s' is too long.", name)
+		}
+		if err := interp.allocate(&interp.memory.Strings, string_size+size); err != nil {
+			return nil, err
+		}
+		return build(), nil
+	}}
+}
+
+// string_argument checks that the argument of the method name is a string.
+func string_argument(name string, arg Value) (string, error) {
+	str, ok := arg.(string)
+	if !ok {
+		return "", fmt.Errorf("Argument to '%s' must be a string.", name)
+	}
+	return str, nil
+}
+
+// string_bound converts a method argument into a character position
+// between 0 and limit inclusive.
+func string_bound(arg Value, limit int) (int, error) {
+	f, ok := arg.(float64)
+	if !ok || f != math.Trunc(f) {
+		return 0, errors.New("String position must be an integer.")
+	}
+	if f < 0 || f > float64(limit) {
+		return 0, fmt.Errorf("String position %s out of range.", stringify(f))
+	}
+	return int(f), nil
+}
+
+// string_index returns the character of str at index as a string.
+func string_index(str string, bracket Token, index Value) (Value, error) {
+	f, ok := index.(float64)
+	if !ok || f != math.Trunc(f) {
+		return nil, RuntimeError{"String index must be an integer.", bracket}
+	}
+	if f >= 0 {
+		i := 0
+		for _, char := range str {
+			if float64(i) == f {
+				return string(char), nil
+			}
+			i++
+		}
+	}
+	length := utf8.RuneCountInString(str)
+	msg := fmt.Sprintf("String index %s out of range for string of length %d.", stringify(f), length)
+	return nil, RuntimeError{msg, bracket}
+}
@@ -0,0 +1,319 @@
+package lox
+
+import (
+	"sort"
+	"strings"
+)
+
+// SymbolKind is the kind of declaration that introduced a Symbol.
+type SymbolKind int
+
+const (
+	VariableSymbol SymbolKind = iota
+	ParameterSymbol
+	FunctionSymbol
+	ClassSymbol
+	MethodSymbol
+	ModuleSymbol
+)
+
+func (sk SymbolKind) String() string {
+	switch sk {
+	case ParameterSymbol:
+		return "parameter"
+	case FunctionSymbol:
+		return "function"
+	case ClassSymbol:
+		return "class"
+	case MethodSymbol:
+		return "method"
+	case ModuleSymbol:
+		return "module"
+	}
+	return "variable"
+}
+
+// Symbol is a name declared in a document, together with every place it is
+// used. Methods are not in any scope and only appear in the outline.
+type Symbol struct {
+	name       Token
+	kind       SymbolKind
+	global     bool
+	loc        Span
+	detail     string
+	visible    Span
+	references []Span
+	reads      int
+	// shadows is the declaration in an enclosing scope hidden by this one.
+	shadows *Symbol
+	// children are the methods of a class, or the functions and classes
+	// declared inside a function.
+	children []*Symbol
+}
+
+// describe returns a one line summary of the declaration, as shown on hover.
+func (sb *Symbol) describe() string {
+	kind := sb.kind.String()
+	if sb.kind == VariableSymbol {
+		if sb.global {
+			kind = "global variable"
+		} else {
+			kind = "local variable"
+		}
+	}
+	return kind + " " + sb.name.lexeme + sb.detail
+}
+
+type index_scope struct {
+	span    Span
+	symbols map[string]*Symbol
+}
+
+type symbol_ref struct {
+	span   Span
+	symbol *Symbol
+}
+
+// global_ref is a use of a name the resolver found in no scope.
+type global_ref struct {
+	name  Token
+	write bool
+}
+
+// SymbolIndex is filled in by the resolver when it analyzes a document for
+// the language server. Local references are linked to their declaration
+// through the scope depth the resolver finds for them, and references to
+// globals by name once the whole document has been seen. All methods can
+// be called on a nil index, which records nothing.
+type SymbolIndex struct {
+	source      string
+	diagnostics []Diagnostic
+	builtins    []string
+	constants   map[string]bool
+	symbols     []*Symbol
+	outline     []*Symbol
+	globals     map[string]*Symbol
+	refs        []symbol_ref
+	scopes      []index_scope
+	containers  []*Symbol
+	global_refs []global_ref
+}
+
+// index scans, parses and resolves source, filling in a SymbolIndex and
+// checking it with lint when that is not nil. Declarations that fail to
+// parse are skipped, so the rest of the document is still indexed. The
+// comments of the source are returned with the index.
+func (interp *Interpreter) index(source string, file string, lint *linter) (*SymbolIndex, []Comment) {
+	interp.begin(source, file)
+	lexer := NewLexer(source, interp.reporter)
+	tokens := lexer.scan_tokens()
+	parser := Parser{tokens: tokens, reporter: interp.reporter, file: file}
+	stmts, _ := parser.parse()
+	index := &SymbolIndex{source: source, globals: make(map[string]*Symbol), constants: make(map[string]bool)}
+	rs := Resolver{interp: interp, init_scopes: new(Stack), index: index, lint: lint}
+	rs.resolve_stmts(stmts, rs.init_scopes)
+	for _, ref := range index.global_refs {
+		if symbol, ok := index.globals[ref.name.lexeme]; ok {
+			index.add_reference(ref.name.span, symbol, ref.write)
+		}
+	}
+	for name, value := range interp.builtins.values {
+		index.builtins = append(index.builtins, name)
+		if _, ok := value.(LoxCallable); !ok {
+			index.constants[name] = true
+		}
+	}
+	sort.Strings(index.builtins)
+	lint.finish(index, lexer.comments)
+	index.diagnostics = interp.diagnostics
+	return index, lexer.comments
+}
+
+func (ix *SymbolIndex) open(span Span) {
+	if ix == nil {
+		return
+	}
+	ix.scopes = append(ix.scopes, index_scope{span, make(map[string]*Symbol)})
+}
+
+// close ends the innermost scope, which also ends the visibility of the
+// names declared in it.
+func (ix *SymbolIndex) close() {
+	if ix == nil {
+		return
+	}
+	scope := ix.scopes[len(ix.scopes)-1]
+	for _, symbol := range scope.symbols {
+		symbol.visible.end = scope.span.end
+	}
+	ix.scopes = ix.scopes[:len(ix.scopes)-1]
+}
+
+// declare records name as declared in the innermost scope, or as a global
+// at the top level.
+func (ix *SymbolIndex) declare(name Token, kind SymbolKind, loc Span, detail string) *Symbol {
+	if ix == nil {
+		return nil
+	}
+	end := Position{offset: len(ix.source)}
+	symbol := &Symbol{name: name, kind: kind, loc: loc, detail: detail, visible: Span{name.span.start, end}}
+	if len(ix.scopes) == 0 {
+		symbol.global = true
+		if _, ok := ix.globals[name.lexeme]; !ok {
+			ix.globals[name.lexeme] = symbol
+		}
+	} else {
+		for i := len(ix.scopes) - 2; i >= 0 && symbol.shadows == nil; i-- {
+			symbol.shadows = ix.scopes[i].symbols[name.lexeme]
+		}
+		ix.scopes[len(ix.scopes)-1].symbols[name.lexeme] = symbol
+	}
+	ix.symbols = append(ix.symbols, symbol)
+	if kind == FunctionSymbol || kind == ClassSymbol {
+		ix.add_child(symbol)
+	}
+	return symbol
+}
+
+// method records a method of the class being resolved.
+func (ix *SymbolIndex) method(method Func) *Symbol {
+	if ix == nil {
+		return nil
+	}
+	symbol := &Symbol{name: method.name, kind: MethodSymbol, loc: method.loc, detail: parameter_list(method.params)}
+	ix.symbols = append(ix.symbols, symbol)
+	ix.add_child(symbol)
+	return symbol
+}
+
+func (ix *SymbolIndex) add_child(symbol *Symbol) {
+	if len(ix.containers) == 0 {
+		ix.outline = append(ix.outline, symbol)
+		return
+	}
+	container := ix.containers[len(ix.containers)-1]
+	container.children = append(container.children, symbol)
+}
+
+// enter makes symbol the container of the declarations that follow, until
+// the matching leave.
+func (ix *SymbolIndex) enter(symbol *Symbol) {
+	if ix == nil {
+		return
+	}
+	ix.containers = append(ix.containers, symbol)
+}
+
+func (ix *SymbolIndex) leave() {
+	if ix == nil {
+		return
+	}
+	ix.containers = ix.containers[:len(ix.containers)-1]
+}
+
+// reference records a use of name that the resolver found depth scopes
+// out, or in no scope at all when depth is -1. write is set when the use
+// assigns to name.
+func (ix *SymbolIndex) reference(name Token, depth int, write bool) {
+	if ix == nil || name.t_type != IDENTIFIER {
+		return
+	}
+	if depth < 0 {
+		ix.global_refs = append(ix.global_refs, global_ref{name, write})
+		return
+	}
+	if symbol, ok := ix.scopes[len(ix.scopes)-1-depth].symbols[name.lexeme]; ok {
+		ix.add_reference(name.span, symbol, write)
+	}
+}
+
+func (ix *SymbolIndex) add_reference(span Span, symbol *Symbol, write bool) {
+	ix.refs = append(ix.refs, symbol_ref{span, symbol})
+	symbol.references = append(symbol.references, span)
+	if !write {
+		symbol.reads++
+	}
+}
+
+// symbol_at returns the symbol declared or referenced at offset, and the
+// span of the name found there.
+func (ix *SymbolIndex) symbol_at(offset int) (*Symbol, Span, bool) {
+	for _, symbol := range ix.symbols {
+		if span_contains(symbol.name.span, offset) {
+			return symbol, symbol.name.span, true
+		}
+	}
+	for _, ref := range ix.refs {
+		if span_contains(ref.span, offset) {
+			return ref.symbol, ref.span, true
+		}
+	}
+	return nil, Span{}, false
+}
+
+// builtin_at returns the name of the native referenced at offset.
+func (ix *SymbolIndex) builtin_at(offset int) (Token, bool) {
+	for _, ref := range ix.global_refs {
+		if _, declared := ix.globals[ref.name.lexeme]; declared || !span_contains(ref.name.span, offset) {
+			continue
+		}
+		if ix.is_builtin(ref.name.lexeme) {
+			return ref.name, true
+		}
+	}
+	return Token{}, false
+}
+
+func (ix *SymbolIndex) is_builtin(name string) bool {
+	for _, builtin := range ix.builtins {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
+
+// visible_at returns the symbols that can be named at offset, sorted by
+// name. An inner declaration hides an outer one of the same name.
+func (ix *SymbolIndex) visible_at(offset int) []*Symbol {
+	visible := make(map[string]*Symbol)
+	for _, symbol := range ix.symbols {
+		if symbol.kind == MethodSymbol {
+			continue
+		}
+		if symbol.global || (symbol.visible.start.offset <= offset && offset <= symbol.visible.end.offset) {
+			if _, ok := visible[symbol.name.lexeme]; !ok || !symbol.global {
+				visible[symbol.name.lexeme] = symbol
+			}
+		}
+	}
+	var symbols []*Symbol
+	for _, symbol := range visible {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].name.lexeme < symbols[j].name.lexeme
+	})
+	return symbols
+}
+
+func span_contains(span Span, offset int) bool {
+	return span.start.offset <= offset && offset <= span.end.offset
+}
+
+// parameter_list formats params as they appear in a declaration.
+func parameter_list(params []Token) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.lexeme
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// superclass_detail is shown after the name of a class on hover.
+func superclass_detail(class Class) string {
+	if class.superclass == nil {
+		return ""
+	}
+	return " < " + class.superclass.name.lexeme
+}
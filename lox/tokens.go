@@ -0,0 +1,97 @@
+package lox
+
+import "fmt"
+
+type TokenType int
+
+const (
+	LEFT_PAREN TokenType = iota
+	RIGHT_PAREN
+	LEFT_BRACE
+	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
+	COMMA
+	COLON
+	DOT
+	MINUS
+	PLUS
+	SEMICOLON
+	SLASH
+	STAR
+	BANG
+	BANG_EQUAL
+	EQUAL
+	EQUAL_EQUAL
+	ARROW
+	GREATER
+	GREATER_EQUAL
+	LESS
+	LESS_EQUAL
+	IDENTIFIER
+	STRING
+	NUMBER
+	AND
+	BREAK
+	CATCH
+	CLASS
+	CONTINUE
+	ELSE
+	FALSE
+	FINALLY
+	FUN
+	FOR
+	IF
+	IMPORT
+	NIL
+	OR
+	PRINT
+	RETURN
+	SUPER
+	THIS
+	THROW
+	TRUE
+	TRY
+	VAR
+	WHILE
+	EOF
+)
+
+type Value interface{}
+
+type Token struct {
+	t_type  TokenType
+	lexeme  string
+	literal Value
+	line    int
+	span    Span
+}
+
+// Position is a point in the source: a line and a column counted in runes,
+// both starting at 1, and the byte offset from the start of the source.
+type Position struct {
+	line   int
+	column int
+	offset int
+}
+
+// Span is the range of source from start up to, but not including, end.
+type Span struct {
+	start Position
+	end   Position
+}
+
+// to returns the span from the start of sp to the end of last.
+func (sp Span) to(last Span) Span {
+	return Span{sp.start, last.end}
+}
+
+// line_token makes a token for code that only knows the line it is on,
+// such as the bytecode VM.
+func line_token(t_type TokenType, lexeme string, line int) Token {
+	return Token{t_type: t_type, lexeme: lexeme, line: line}
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%v %s %v", t.t_type, t.lexeme, t.literal)
+}
@@ -0,0 +1,137 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// trace_frame is one active call in the stack trace of a runtime error.
+// line is where the call was executing: the call site for outer frames and
+// the failing statement for the innermost one.
+type trace_frame struct {
+	name string
+	file string
+	line int
+}
+
+// Deep traces are printed with their innermost trace_head and outermost
+// trace_tail lines. A frame repeated in a row, as in direct recursion, is
+// printed at most trace_repeats times.
+const (
+	trace_head    = 20
+	trace_tail    = 5
+	trace_repeats = 3
+)
+
+// push_frame records a call to name, declared in file, on the call stack
+// of the tree-walking backend.
+func (interp *Interpreter) push_frame(name string, file string) {
+	interp.frames = append(interp.frames, trace_frame{name, file, 0})
+}
+
+func (interp *Interpreter) pop_frame() {
+	interp.frames = interp.frames[:len(interp.frames)-1]
+}
+
+// capture_trace keeps frames, outermost first, as the trace of err unless
+// the error already carries one from a deeper frame.
+func (interp *Interpreter) capture_trace(frames []trace_frame, err error) {
+	if interp.trace != nil {
+		return
+	}
+	var line int
+	switch t := err.(type) {
+	case RuntimeError:
+		line = t.token.line
+	case ThrowVal:
+		line = t.token.line
+	case LimitError:
+		line = t.line
+	default:
+		return
+	}
+	interp.trace = append([]trace_frame{}, frames...)
+	if len(interp.trace) > 0 {
+		interp.trace[len(interp.trace)-1].line = line
+	}
+}
+
+// capture_trace records the frames active on the VM when err is raised.
+func (vm *VM) capture_trace(err error) {
+	if vm.interp.trace != nil {
+		return
+	}
+	frames := make([]trace_frame, len(vm.frames))
+	for i, frame := range vm.frames {
+		function := frame.closure.function
+		name := function.name
+		if name == "" {
+			name = "<script>"
+		}
+		frames[i] = trace_frame{name, function.file, 0}
+		if frame.ip > 0 {
+			frames[i].line = function.chunk.lines[frame.ip-1]
+		}
+	}
+	vm.interp.capture_trace(frames, err)
+}
+
+// trace_line is one printed line of a trace and the frames it stands for.
+type trace_line struct {
+	text   string
+	frames int
+}
+
+// write_trace prints trace innermost first, collapsing repeated frames and
+// eliding the middle of traces too deep to be read.
+func write_trace(w io.Writer, trace []trace_frame) {
+	var lines []trace_line
+	for i := len(trace) - 1; i >= 0; {
+		frame := trace[i]
+		run := 1
+		for i-run >= 0 && trace[i-run] == frame {
+			run++
+		}
+		text := fmt.Sprintf("  at %s (%s:%d)", frame.name, display_file(frame.file), frame.line)
+		for j := 0; j < run && j < trace_repeats; j++ {
+			lines = append(lines, trace_line{text, 1})
+		}
+		if run > trace_repeats {
+			more := run - trace_repeats
+			lines = append(lines, trace_line{fmt.Sprintf("  ... previous frame repeated %d more times", more), more})
+		}
+		i -= run
+	}
+	if len(lines) > trace_head+trace_tail+1 {
+		omitted := 0
+		for _, line := range lines[trace_head : len(lines)-trace_tail] {
+			omitted += line.frames
+		}
+		elided := trace_line{fmt.Sprintf("  ... %d more frames ...", omitted), omitted}
+		lines = append(append(lines[:trace_head:trace_head], elided), lines[len(lines)-trace_tail:]...)
+	}
+	for _, line := range lines {
+		fmt.Fprintln(w, line.text)
+	}
+}
+
+// display_file names file relative to the working directory when it is
+// inside it, and by its absolute path otherwise, so that the script and
+// the modules it imports are shown alike.
+func display_file(file string) string {
+	if file == "" {
+		return "<input>"
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+	return file
+}
@@ -0,0 +1,546 @@
+package lox
+
+import (
+	"fmt"
+)
+
+// Closure is a compiled function together with the variables it captured.
+type Closure struct {
+	function *Function
+	upvalues []*Upvalue
+	globals  *Environment
+}
+
+func (cl *Closure) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return interp.get_vm().invoke(cl, cl, arguments)
+}
+
+func (cl *Closure) arity() int {
+	return cl.function.n_params
+}
+
+func (cl *Closure) bind(instance LoxInstance) LoxCallable {
+	return BoundMethod{instance, cl}
+}
+
+func (cl *Closure) String() string {
+	return cl.function.String()
+}
+
+// BoundMethod is a compiled method paired with the instance it was
+// accessed on.
+type BoundMethod struct {
+	receiver LoxInstance
+	method   *Closure
+}
+
+func (bm BoundMethod) call(interp *Interpreter, arguments []Value) (Value, error) {
+	return interp.get_vm().invoke(bm.method, bm.receiver, arguments)
+}
+
+func (bm BoundMethod) arity() int {
+	return bm.method.arity()
+}
+
+func (bm BoundMethod) String() string {
+	return bm.method.String()
+}
+
+// Upvalue refers to a captured variable. While open it points at a stack
+// slot; once that slot goes away the value is moved into closed.
+type Upvalue struct {
+	slot   int
+	closed Value
+	open   bool
+}
+
+type CallFrame struct {
+	closure *Closure
+	ip      int
+	slots   int
+}
+
+// Handler is an exception handler installed by OP_TRY. It records how
+// much of the stack to keep and where execution resumes.
+type Handler struct {
+	frames  int
+	stack   int
+	ip      int
+	finally bool
+}
+
+// VM executes compiled chunks on a value stack.
+type VM struct {
+	interp        *Interpreter
+	stack         []Value
+	frames        []CallFrame
+	open_upvalues []*Upvalue
+	handlers      []Handler
+}
+
+func (interp *Interpreter) get_vm() *VM {
+	if interp.vm == nil {
+		interp.vm = &VM{interp: interp}
+	}
+	return interp.vm
+}
+
+func (interp *Interpreter) run_bytecode(function *Function) error {
+	closure := &Closure{function, nil, interp.globals}
+	interp.trace = nil
+	_, err := interp.get_vm().invoke(closure, closure, nil)
+	if err != nil {
+		interp.runtime_error(uncaught(err))
+		return err
+	}
+	return nil
+}
+
+// invoke calls closure from Go, with receiver in slot zero, and runs the
+// VM until that call returns.
+func (vm *VM) invoke(closure *Closure, receiver Value, arguments []Value) (Value, error) {
+	base := len(vm.frames)
+	stack_top := len(vm.stack)
+	vm.push(receiver)
+	vm.stack = append(vm.stack, arguments...)
+	err := vm.call_closure(closure, len(arguments), 0)
+	if err != nil {
+		vm.stack = vm.stack[:stack_top]
+		return nil, err
+	}
+	value, err := vm.run(base)
+	if err != nil {
+		vm.close_upvalues(stack_top)
+		vm.frames = vm.frames[:base]
+		vm.stack = vm.stack[:stack_top]
+		vm.drop_handlers()
+		return nil, err
+	}
+	return value, nil
+}
+
+// run executes until the frame at base returns, resuming at the innermost
+// handler whenever an error is raised inside a try.
+func (vm *VM) run(base int) (Value, error) {
+	for {
+		value, err := vm.execute(base)
+		if err == nil {
+			return value, nil
+		}
+		vm.capture_trace(err)
+		if !vm.catch(err, base) {
+			return nil, err
+		}
+	}
+}
+
+// pending_error is pushed for a finally handler, so that OP_RETHROW can
+// raise the error again with the trace it had.
+type pending_error struct {
+	err   error
+	trace []trace_frame
+}
+
+// catch unwinds to the innermost handler installed above base and pushes
+// the caught value, or the pending error for a finally handler.
+func (vm *VM) catch(err error, base int) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	handler := vm.handlers[len(vm.handlers)-1]
+	if handler.frames <= base {
+		return false
+	}
+	var value Value = pending_error{err, vm.interp.trace}
+	if !handler.finally {
+		caught, ok := caught_value(err)
+		if !ok || vm.interp.out_of_memory() {
+			return false
+		}
+		value = caught
+	}
+	vm.interp.trace = nil
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.close_upvalues(handler.stack)
+	vm.frames = vm.frames[:handler.frames]
+	vm.stack = vm.stack[:handler.stack]
+	vm.push(value)
+	vm.frames[len(vm.frames)-1].ip = handler.ip
+	return true
+}
+
+// drop_handlers removes the handlers of frames that have been unwound.
+func (vm *VM) drop_handlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frames > len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+func (vm *VM) execute(base int) (Value, error) {
+	frame := &vm.frames[len(vm.frames)-1]
+	for {
+		chunk := &frame.closure.function.chunk
+		line := chunk.lines[frame.ip]
+		op := OpCode(chunk.code[frame.ip])
+		frame.ip++
+		if vm.interp.limited {
+			if err := vm.interp.tick(line); err != nil {
+				return nil, err
+			}
+		}
+		switch op {
+		case OP_CONSTANT:
+			vm.push(chunk.constants[vm.read_short(frame)])
+		case OP_NIL:
+			vm.push(nil)
+		case OP_TRUE:
+			vm.push(true)
+		case OP_FALSE:
+			vm.push(false)
+		case OP_POP:
+			vm.pop()
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.slots+vm.read_byte(frame)])
+		case OP_SET_LOCAL:
+			vm.stack[frame.slots+vm.read_byte(frame)] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := vm.read_name(frame, line)
+			value, err := vm.interp.get_global(frame.closure.globals, name)
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			name := vm.read_name(frame, line)
+			if err := vm.interp.allocate_at(name, &vm.interp.memory.Environments, variable_size); err != nil {
+				return nil, err
+			}
+			frame.closure.globals.define(name.lexeme, vm.pop())
+		case OP_SET_GLOBAL:
+			name := vm.read_name(frame, line)
+			if err := frame.closure.globals.assign(name, vm.peek(0)); err != nil {
+				return nil, err
+			}
+		case OP_GET_UPVALUE:
+			upvalue := frame.closure.upvalues[vm.read_byte(frame)]
+			if upvalue.open {
+				vm.push(vm.stack[upvalue.slot])
+			} else {
+				vm.push(upvalue.closed)
+			}
+		case OP_SET_UPVALUE:
+			upvalue := frame.closure.upvalues[vm.read_byte(frame)]
+			if upvalue.open {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			} else {
+				upvalue.closed = vm.peek(0)
+			}
+		case OP_GET_PROPERTY:
+			name := vm.read_name(frame, line)
+			value, err := get_property(vm.pop(), name)
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_SET_PROPERTY:
+			name := vm.read_name(frame, line)
+			value := vm.pop()
+			object := vm.pop()
+			if err := vm.interp.allocate_store(object, name.lexeme, name); err != nil {
+				return nil, err
+			}
+			if err := set_property(object, name, value); err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_GET_SUPER:
+			name := vm.read_name(frame, line)
+			superclass := vm.pop().(*LoxClass)
+			object := vm.pop().(LoxInstance)
+			method, ok := superclass.find_method(name.lexeme)
+			if !ok {
+				return nil, RuntimeError{"Undefined property '" + name.lexeme + "'.", name}
+			}
+			vm.push(method.bind(object))
+		case OP_GET_INDEX:
+			index := vm.pop()
+			value, err := get_index(vm.pop(), line_token(RIGHT_BRACKET, "]", line), index)
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_SET_INDEX:
+			value := vm.pop()
+			index := vm.pop()
+			object := vm.pop()
+			bracket := line_token(RIGHT_BRACKET, "]", line)
+			if err := vm.interp.allocate_store(object, index, bracket); err != nil {
+				return nil, err
+			}
+			if err := set_index(object, bracket, index, value); err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_LIST:
+			count := vm.read_short(frame)
+			elements := make([]Value, count)
+			copy(elements, vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			bracket := line_token(LEFT_BRACKET, "[", line)
+			if err := vm.interp.allocate_at(bracket, &vm.interp.memory.Collections, list_size+element_size*count); err != nil {
+				return nil, err
+			}
+			vm.push(&LoxList{elements})
+		case OP_MAP:
+			count := vm.read_short(frame)
+			entries := new_lox_map()
+			brace := line_token(LEFT_BRACE, "{", line)
+			if err := vm.interp.allocate_at(brace, &vm.interp.memory.Collections, map_size); err != nil {
+				return nil, err
+			}
+			for i := len(vm.stack) - 2*count; i < len(vm.stack); i += 2 {
+				if err := vm.interp.allocate_store(entries, vm.stack[i], brace); err != nil {
+					return nil, err
+				}
+				if err := check_key(brace, vm.stack[i]); err != nil {
+					return nil, err
+				}
+				entries.store(vm.stack[i], vm.stack[i+1])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*count]
+			vm.push(entries)
+		case OP_EQUAL:
+			right := vm.pop()
+			vm.push(is_equal(vm.pop(), right))
+		case OP_NOT_EQUAL:
+			right := vm.pop()
+			vm.push(!is_equal(vm.pop(), right))
+		case OP_GREATER, OP_GREATER_EQUAL, OP_LESS, OP_LESS_EQUAL, OP_ADD, OP_SUBTRACT, OP_MULTIPLY, OP_DIVIDE:
+			right := vm.pop()
+			left := vm.pop()
+			operator := line_token(vm_operators[op], "", line)
+			value, err := binary_op(operator, left, right)
+			if err != nil {
+				return nil, err
+			}
+			if str, ok := value.(string); ok {
+				if err := vm.interp.allocate_at(operator, &vm.interp.memory.Strings, string_size+len(str)); err != nil {
+					return nil, err
+				}
+			}
+			vm.push(value)
+		case OP_NOT:
+			vm.push(!is_truthy(vm.pop()))
+		case OP_NEGATE:
+			value, err := unary_op(line_token(MINUS, "-", line), vm.pop())
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_PRINT:
+			fmt.Fprintln(vm.interp.stdout, stringify(vm.pop()))
+		case OP_JUMP:
+			offset := vm.read_short(frame)
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := vm.read_short(frame)
+			if !is_truthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := vm.read_short(frame)
+			frame.ip -= offset
+		case OP_CALL:
+			arg_count := vm.read_byte(frame)
+			if err := vm.call_value(vm.peek(arg_count), arg_count, line); err != nil {
+				return nil, err
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+		case OP_CLOSURE:
+			function := chunk.constants[vm.read_short(frame)].(*Function)
+			bytes := closure_size + upvalue_size*function.upvalue_count
+			if err := vm.interp.allocate_at(line_token(FUN, "fun", line), &vm.interp.memory.Closures, bytes); err != nil {
+				return nil, err
+			}
+			closure := &Closure{function, make([]*Upvalue, function.upvalue_count), frame.closure.globals}
+			for i := range closure.upvalues {
+				is_local := vm.read_byte(frame) == 1
+				index := vm.read_byte(frame)
+				if is_local {
+					closure.upvalues[i] = vm.capture_upvalue(frame.slots + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case OP_CLOSE_UPVALUE:
+			vm.close_upvalues(len(vm.stack) - 1)
+			vm.pop()
+		case OP_RETURN:
+			result := vm.pop()
+			vm.close_upvalues(frame.slots)
+			vm.stack = vm.stack[:frame.slots]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == base {
+				return result, nil
+			}
+			vm.push(result)
+			frame = &vm.frames[len(vm.frames)-1]
+		case OP_TRY:
+			offset := vm.read_short(frame)
+			handler := Handler{len(vm.frames), len(vm.stack), frame.ip + offset, false}
+			handler.finally = vm.read_byte(frame) == 1
+			vm.handlers = append(vm.handlers, handler)
+		case OP_END_TRY:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OP_IMPORT:
+			path := chunk.constants[vm.read_short(frame)].(string)
+			file := chunk.constants[vm.read_short(frame)].(string)
+			module, err := vm.interp.import_module(line_token(IMPORT, "import", line), path, file)
+			if err != nil {
+				return nil, err
+			}
+			// Loading the module may have grown the frame stack.
+			frame = &vm.frames[len(vm.frames)-1]
+			vm.push(module)
+		case OP_THROW:
+			return nil, ThrowVal{vm.pop(), line_token(THROW, "throw", line)}
+		case OP_RETHROW:
+			pending := vm.pop().(pending_error)
+			vm.interp.trace = pending.trace
+			return nil, pending.err
+		case OP_CLASS:
+			name := chunk.constants[vm.read_short(frame)].(string)
+			klass := LoxClass{name, nil, make(map[string]Method)}
+			if vm.read_byte(frame) == 1 {
+				superclass, ok := vm.pop().(LoxClass)
+				if !ok {
+					return nil, RuntimeError{"Superclass must be a class", line_token(IDENTIFIER, "", line)}
+				}
+				klass.superclass = &superclass
+			}
+			vm.push(klass)
+		case OP_SUPERCLASS:
+			vm.push(vm.pop().(LoxClass).superclass)
+		case OP_METHOD:
+			name := chunk.constants[vm.read_short(frame)].(string)
+			method := vm.pop().(*Closure)
+			vm.peek(0).(LoxClass).methods[name] = method
+		default:
+			return nil, RuntimeError{fmt.Sprintf("Internal error, unknown opcode %d", op), Token{line: line}}
+		}
+	}
+}
+
+var vm_operators = map[OpCode]TokenType{
+	OP_GREATER:       GREATER,
+	OP_GREATER_EQUAL: GREATER_EQUAL,
+	OP_LESS:          LESS,
+	OP_LESS_EQUAL:    LESS_EQUAL,
+	OP_ADD:           PLUS,
+	OP_SUBTRACT:      MINUS,
+	OP_MULTIPLY:      STAR,
+	OP_DIVIDE:        SLASH,
+}
+
+func (vm *VM) call_value(callee Value, arg_count int, line int) error {
+	switch t := callee.(type) {
+	case *Closure:
+		return vm.call_closure(t, arg_count, line)
+	case BoundMethod:
+		vm.stack[len(vm.stack)-arg_count-1] = t.receiver
+		return vm.call_closure(t.method, arg_count, line)
+	case LoxClass:
+		if initializer, ok := t.find_method("init"); ok {
+			if closure, ok := initializer.(*Closure); ok {
+				paren := line_token(RIGHT_PAREN, ")", line)
+				if err := vm.interp.allocate_at(paren, &vm.interp.memory.Instances, instance_size); err != nil {
+					return err
+				}
+				vm.stack[len(vm.stack)-arg_count-1] = LoxInstance{t, make(map[string]Value)}
+				return vm.call_closure(closure, arg_count, line)
+			}
+		}
+	}
+	arguments := make([]Value, arg_count)
+	copy(arguments, vm.stack[len(vm.stack)-arg_count:])
+	paren := line_token(RIGHT_PAREN, ")", line)
+	result, err := vm.interp.call_value(callee, paren, arguments)
+	if err != nil {
+		return err
+	}
+	vm.stack = vm.stack[:len(vm.stack)-arg_count-1]
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) call_closure(closure *Closure, arg_count int, line int) error {
+	if arg_count != closure.function.n_params {
+		msg := fmt.Sprintf("Expected %d arguments but got %d.", closure.function.n_params, arg_count)
+		return RuntimeError{msg, line_token(RIGHT_PAREN, ")", line)}
+	}
+	if err := vm.interp.check_depth(len(vm.frames), line); err != nil {
+		return err
+	}
+	vm.frames = append(vm.frames, CallFrame{closure, 0, len(vm.stack) - arg_count - 1})
+	return nil
+}
+
+func (vm *VM) capture_upvalue(slot int) *Upvalue {
+	for _, upvalue := range vm.open_upvalues {
+		if upvalue.slot == slot {
+			return upvalue
+		}
+	}
+	upvalue := &Upvalue{slot: slot, open: true}
+	vm.open_upvalues = append(vm.open_upvalues, upvalue)
+	return upvalue
+}
+
+// close_upvalues moves every captured variable at or above slot last off
+// the stack.
+func (vm *VM) close_upvalues(last int) {
+	still_open := vm.open_upvalues[:0]
+	for _, upvalue := range vm.open_upvalues {
+		if upvalue.slot >= last {
+			upvalue.closed = vm.stack[upvalue.slot]
+			upvalue.open = false
+		} else {
+			still_open = append(still_open, upvalue)
+		}
+	}
+	vm.open_upvalues = still_open
+}
+
+func (vm *VM) read_byte(frame *CallFrame) int {
+	b := frame.closure.function.chunk.code[frame.ip]
+	frame.ip++
+	return int(b)
+}
+
+func (vm *VM) read_short(frame *CallFrame) int {
+	n := frame.closure.function.chunk.read_short(frame.ip)
+	frame.ip += 2
+	return n
+}
+
+// read_name reads a constant operand naming a variable or property and
+// turns it into a token for error reporting.
+func (vm *VM) read_name(frame *CallFrame, line int) Token {
+	name := frame.closure.function.chunk.constants[vm.read_short(frame)].(string)
+	return line_token(IDENTIFIER, name, line)
+}
+
+func (vm *VM) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
@@ -1,103 +1,286 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+
+	"glox/lox"
 )
 
-var static_error = false
-var run_error = false
-var in_repl = false
+var backend_name = flag.String("backend", "tree", "execution backend, either tree or vm")
+var diagnostics_name = flag.String("diagnostics", "text", "diagnostic output format, either text or json")
+var max_steps = flag.Int("max-steps", 0, "stop after evaluating this many statements and expressions, or instructions on the vm")
+var timeout = flag.Duration("timeout", 0, "stop after running for this long")
+var max_depth = flag.Int("max-depth", 0, fmt.Sprintf("maximum call depth (default %d)", lox.DefaultMaxDepth))
+var max_memory = flag.Int64("max-memory", 0, "stop once the script has allocated about this many bytes")
+var allow = flag.String("allow", "clock", "comma-separated capabilities granted to the script: clock, fs, fs-read, env, process")
+var root = flag.String("root", ".", "directory the fs and fs-read capabilities are confined to")
 
 func main() {
-	if len(os.Args) > 2 {
-		fmt.Println("Usage: glox [script]")
-	} else if len(os.Args) == 2 {
-		run_file(os.Args[1])
+	flag.Parse()
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "disasm" {
+		disasm(args[1:])
+	} else if len(args) == 2 && args[0] == "debug" {
+		debug(args[1])
+	} else if len(args) > 0 && args[0] == "lint" {
+		lint(args[1:])
+	} else if len(args) > 0 && args[0] == "fmt" {
+		format(args[1:])
+	} else if len(args) == 1 && args[0] == "lsp" {
+		serve_lsp()
+	} else if len(args) == 1 && args[0] == "dap" {
+		serve_dap()
+	} else if len(args) > 1 {
+		usage()
+	} else if len(args) == 1 {
+		run_file(args[0])
 	} else {
 		run_prompt()
 	}
 }
 
+func usage() {
+	fmt.Println("Usage: glox [-backend tree|vm] [-diagnostics text|json] [-max-steps n] [-timeout d] [-max-depth n] [-max-memory n] [-allow list] [-root dir] [script]")
+	fmt.Println("       glox debug script")
+	fmt.Println("       glox disasm script")
+	fmt.Println("       glox fmt [-check|-write] file...")
+	fmt.Println("       glox lint [-config file] file...")
+	fmt.Println("       glox lsp")
+	fmt.Println("       glox dap")
+}
+
+func backend() lox.Backend {
+	switch *backend_name {
+	case "tree":
+		return lox.TreeWalk
+	case "vm":
+		return lox.Bytecode
+	}
+	fmt.Fprintf(os.Stderr, "Unknown backend '%s', expected tree or vm\n", *backend_name)
+	os.Exit(64)
+	return lox.TreeWalk
+}
+
+func diagnostic_format() lox.DiagnosticFormat {
+	switch *diagnostics_name {
+	case "text":
+		return lox.TextDiagnostics
+	case "json":
+		return lox.JSONDiagnostics
+	}
+	fmt.Fprintf(os.Stderr, "Unknown diagnostic format '%s', expected text or json\n", *diagnostics_name)
+	os.Exit(64)
+	return lox.TextDiagnostics
+}
+
+func limits() lox.Option {
+	return lox.WithLimits(lox.Limits{MaxSteps: *max_steps, Timeout: *timeout, MaxDepth: *max_depth, MaxMemory: *max_memory})
+}
+
+// capabilities grants the modules listed by -allow.
+func capabilities() lox.Option {
+	var granted []lox.Capability
+	for _, name := range strings.Split(*allow, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "clock":
+			granted = append(granted, lox.AllowClock())
+		case "fs":
+			granted = append(granted, lox.AllowFiles(*root, lox.ReadWrite))
+		case "fs-read":
+			granted = append(granted, lox.AllowFiles(*root, lox.ReadOnly))
+		case "env":
+			granted = append(granted, lox.AllowEnv())
+		case "process":
+			granted = append(granted, lox.AllowProcess())
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown capability '%s', expected clock, fs, fs-read, env or process\n", name)
+			os.Exit(64)
+		}
+	}
+	return lox.WithCapabilities(granted...)
+}
+
 func run_file(name string) {
-	bytes, err := os.ReadFile(name)
-	if err != nil {
+	interp := lox.NewInterpreter(lox.WithBackend(backend()), lox.WithDiagnosticFormat(diagnostic_format()), limits(), capabilities())
+	err := interp.RunFile(name)
+	if _, ok := err.(*os.PathError); ok {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	source := string(bytes[:])
-	run(source)
-	// if err != nil {
-	//     fmt.Fprintln(os.Stderr, err)
-	//     os.Exit(65)
-	// }
-	if static_error {
+	if _, ok := err.(lox.StaticError); ok {
+		fmt.Println(err)
 		os.Exit(65)
 	}
 }
 
-func run_prompt() {
-	in_repl = true
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Print("> ")
-	for scanner.Scan() {
-		source := scanner.Text()
-		if source == "quit" {
-			break
-		}
-		run(source)
-		static_error = false
-		fmt.Print("> ")
+func debug(name string) {
+	interp := lox.NewInterpreter(lox.WithDiagnosticFormat(diagnostic_format()), capabilities())
+	err := interp.Debug(name, os.Stdin, os.Stdout)
+	if _, ok := err.(*os.PathError); ok {
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	if err := scanner.Err(); err != nil {
+	if _, ok := err.(lox.StaticError); ok {
 		fmt.Println(err)
+		os.Exit(65)
 	}
-	fmt.Println("Bye")
 }
 
-func run(source string) {
-	lscanner := NewLexer(source)
-	tokens := lscanner.scan_tokens()
-	parser := Parser{tokens: tokens}
-	stmts, err := parser.parse()
+func disasm(args []string) {
+	if len(args) != 1 {
+		usage()
+		os.Exit(64)
+	}
+	bytes, err := os.ReadFile(args[0])
 	if err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
-	if static_error {
-		fmt.Println("Error occurred while parsing")
-		return
+	interp := lox.NewInterpreter(lox.WithDiagnosticFormat(diagnostic_format()))
+	if err := interp.Disassemble(string(bytes)); err != nil {
+		fmt.Println(err)
+		os.Exit(65)
 	}
-	resolve(stmts)
-	if static_error {
-		fmt.Println("Error occurred while resolving")
-		return
+}
+
+// format prints the formatted files, or with -check lists those that are
+// not formatted and with -write rewrites them.
+func format(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "exit with status 1 if any file is not formatted")
+	write := flags.Bool("write", false, "rewrite files in place")
+	flags.Parse(args)
+	if flags.NArg() == 0 || (*check && *write) {
+		usage()
+		os.Exit(64)
 	}
-	interpret(stmts)
-	if run_error {
-		return
+	status := 0
+	for _, name := range flags.Args() {
+		bytes, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		interp := lox.NewInterpreter(lox.WithDiagnosticFormat(diagnostic_format()))
+		formatted, err := interp.Format(string(bytes), name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(65)
+		}
+		switch {
+		case *check:
+			if formatted != string(bytes) {
+				fmt.Println(name)
+				status = 1
+			}
+		case *write:
+			if formatted != string(bytes) {
+				if err := os.WriteFile(name, []byte(formatted), 0644); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
 	}
+	os.Exit(status)
 }
 
-func line_error(line int, message string) {
-	report(line, "", message)
+// lint checks files and exits with status 1 if there were warnings, or
+// 65 if a file has errors.
+func lint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	config_path := flags.String("config", "", "lint config file, instead of the nearest "+lox.LintConfigFile)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		usage()
+		os.Exit(64)
+	}
+	status := 0
+	for _, name := range flags.Args() {
+		bytes, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		var config lox.LintConfig
+		if *config_path != "" {
+			config, err = lox.LoadLintConfig(*config_path)
+		} else {
+			config, err = lox.FindLintConfig(name)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		interp := lox.NewInterpreter(lox.WithDiagnosticFormat(diagnostic_format()))
+		if err := interp.Lint(string(bytes), name, config); err != nil {
+			status = 65
+		} else if len(interp.Diagnostics()) > 0 && status == 0 {
+			status = 1
+		}
+	}
+	os.Exit(status)
 }
 
-func token_error(token Token, message string) {
-	if token.t_type == EOF {
-		report(token.line, "at end", message)
-	} else {
-		report(token.line, "at '"+token.lexeme+"'", message)
+func serve_lsp() {
+	if err := lox.ServeLSP(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
-func runtime_error(re RuntimeError) {
-	fmt.Fprintf(os.Stderr, "%s\n[line %d]\n", re.message, re.token.line)
-	run_error = true
+func serve_dap() {
+	if err := lox.ServeDAP(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func report(line int, where, message string) {
-	fmt.Fprintf(os.Stderr, "[line %d] Error%s: %s", line, where, message)
-	static_error = true
+// run_prompt runs the REPL. Entries left with brackets or a string open
+// are continued on the following lines.
+func run_prompt() {
+	interp := lox.NewInterpreter(lox.WithRepl(), lox.WithBackend(backend()), lox.WithDiagnosticFormat(diagnostic_format()), limits(), capabilities())
+	reader := new_line_reader()
+	defer reader.close()
+	for {
+		source, err := read_entry(reader)
+		if err == err_interrupt {
+			continue
+		}
+		if strings.TrimSpace(source) == "quit" {
+			break
+		}
+		if strings.TrimSpace(source) != "" {
+			err := interp.Run(source)
+			if _, ok := err.(lox.StaticError); ok {
+				fmt.Println(err)
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println(err)
+			}
+			break
+		}
+	}
+	fmt.Println("Bye")
+}
+
+// read_entry reads a line, followed by continuation lines for as long as
+// the entry is incomplete.
+func read_entry(reader line_reader) (string, error) {
+	source, err := reader.read_line("> ")
+	for err == nil && lox.Incomplete(source) {
+		var line string
+		line, err = reader.read_line("... ")
+		source += "\n" + line
+	}
+	return source, err
 }
@@ -0,0 +1,10 @@
+//go:build darwin || freebsd || netbsd || openbsd
+
+package main
+
+import "syscall"
+
+const (
+	get_termios = syscall.TIOCGETA
+	set_termios = syscall.TIOCSETA
+)
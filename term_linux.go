@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+const (
+	get_termios = syscall.TCGETS
+	set_termios = syscall.TCSETS
+)
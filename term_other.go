@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "errors"
+
+// Line editing is only supported on Unix terminals. Elsewhere the REPL
+// reads plain lines.
+func is_terminal(fd int) bool {
+	return false
+}
+
+func make_raw(fd int) (func(), error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
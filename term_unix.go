@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func termios(fd int, request uintptr, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func is_terminal(fd int) bool {
+	var state syscall.Termios
+	return termios(fd, get_termios, &state) == nil
+}
+
+// make_raw switches the terminal to raw input, so that keys arrive one at
+// a time without being echoed, and returns a function restoring it.
+// Output processing is left on, so newlines still return the carriage.
+func make_raw(fd int) (func(), error) {
+	var old syscall.Termios
+	if err := termios(fd, get_termios, &old); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termios(fd, set_termios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { termios(fd, set_termios, &old) }, nil
+}